@@ -0,0 +1,84 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/stefan65535/helmer/internal/domain"
+	"github.com/stefan65535/helmer/internal/logger"
+)
+
+func init() {
+	rootCmd.AddCommand(cacheCmd)
+	cacheCmd.AddCommand(cacheListCmd)
+	cacheCmd.AddCommand(cachePruneCmd)
+	cacheCmd.AddCommand(cacheClearCmd)
+	cachePruneCmd.Flags().DurationVar(&PruneMaxAge, "max-age", 30*24*time.Hour, "remove charts not used within this duration")
+}
+
+var PruneMaxAge time.Duration
+
+var cacheCmd = &cobra.Command{
+	Use:   "cache",
+	Short: "Manage the chart cache",
+	Long:  "Manage the chart cache. \nCharts fetched from chart repositories and OCI registries are stored in a cache directory by content digest, so they are not fetched again on later runs",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+		os.Exit(1)
+	},
+}
+
+var cacheListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List cached charts",
+	Args:  cobra.NoArgs,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		charts, err := domain.GlobalChartCache.List()
+		if err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tVERSION\tDIGEST\tSIZE\tLAST USED\tSOURCE")
+		for _, chart := range charts {
+			fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", chart.Name, chart.Version, chart.Digest, chart.Size, chart.LastUsed.Format(time.DateTime), chart.Source)
+		}
+		w.Flush()
+	},
+}
+
+var cachePruneCmd = &cobra.Command{
+	Use:   "prune",
+	Short: "Remove cached charts not used recently",
+	Args:  cobra.NoArgs,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		pruned, err := domain.GlobalChartCache.Prune(time.Now().Add(-PruneMaxAge))
+		if err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		for _, chart := range pruned {
+			fmt.Printf("Removed %v %v %v\n", chart.Name, chart.Version, chart.Digest)
+		}
+	},
+}
+
+var cacheClearCmd = &cobra.Command{
+	Use:   "clear",
+	Short: "Remove all cached charts",
+	Args:  cobra.NoArgs,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := domain.GlobalChartCache.Clear(); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+	},
+}
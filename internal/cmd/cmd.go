@@ -6,6 +6,7 @@ import (
 	"runtime/debug"
 
 	"github.com/spf13/cobra"
+	"github.com/stefan65535/helmer/internal/domain"
 )
 
 var rootCmd = &cobra.Command{
@@ -27,6 +28,9 @@ func Execute() {
 
 func init() {
 	rootCmd.AddCommand(versionCmd)
+	rootCmd.PersistentFlags().StringVar(&domain.GlobalRegistrySettings.CredentialsFile, "registry-config", "", "path to the registry config file used to pull OCI charts. If not set the Helm registry config is used with fallback to the Docker config")
+	rootCmd.PersistentFlags().StringVar(&domain.GlobalChartCache.Dir, "cache-dir", "", "directory to cache fetched charts in. If not set $HELMER_CACHE_DIR is used, or helmer in the user cache directory")
+	rootCmd.PersistentFlags().BoolVar(&domain.GlobalRegistrySettings.PlainHTTP, "plain-http", false, "use insecure HTTP connections when pulling OCI charts")
 }
 
 var versionCmd = &cobra.Command{
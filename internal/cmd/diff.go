@@ -0,0 +1,224 @@
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stefan65535/helmer/internal/domain"
+	"github.com/stefan65535/helmer/internal/logger"
+)
+
+func init() {
+	rootCmd.AddCommand(diffCmd)
+	diffCmd.Flags().StringVar(&OutputDir, "output-dir", "", "set target root output directory to compare rendered templates with. If not set current working directory will be used")
+	diffCmd.Flags().BoolVarP(&Verbose, "verbose", "v", false, "enable verbose output")
+	diffCmd.Flags().StringVar(&LockFile, "lock-file", domain.DefaultLockfile, "lockfile to verify resolved charts against. Verification is skipped if the file doesn't exist")
+	diffCmd.Flags().StringVarP(&DiffOutput, "output", "o", diffOutputUnified, "output format. One of: unified, semantic, json")
+	addRenderFlags(diffCmd)
+}
+
+var DiffOutput string
+
+const (
+	diffOutputUnified  = "unified"
+	diffOutputSemantic = "semantic"
+	diffOutputJSON     = "json"
+)
+
+// diffExitCode is the exit code used when rendered targets differ from the files on disk.
+const diffExitCode = 2
+
+var diffCmd = &cobra.Command{
+	Use:   "diff config...",
+	Short: "Show changes between rendered templates and the target files on disk",
+	Long:  "Show changes between rendered templates and the target files on disk. \nTargets are rendered in memory exactly as with the template command and compared resource by resource with the files found under the output directory. Resources are matched by apiVersion, kind, namespace and name. Files Helmer wrote in an earlier run that are no longer rendered, according to the .helmer-files index of the target, are reported as removed. Nothing is written.\nThe unified format prints a line diff per resource. The semantic and json formats list added, removed and changed resources with the paths of changed fields, ignoring formatting and document order.\nExits with code 2 if any changes are found",
+	Args:  cobra.MinimumNArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if Verbose {
+			logger.Default.Level = logger.VERBOSE
+		}
+
+		if DiffOutput != diffOutputUnified && DiffOutput != diffOutputSemantic && DiffOutput != diffOutputJSON {
+			logger.Error(fmt.Errorf("unknown output format %v", DiffOutput))
+			os.Exit(1)
+		}
+
+		if err := parseValueFlags(); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		renderedFiles := renderedFileSet{index: make(map[string]int)}
+		for _, arg := range args {
+			err := walkDir(arg, []string{".yml", ".yaml"}, func(path string) error {
+				doc, err := renderConfig(path)
+				if err != nil || doc == nil {
+					return err
+				}
+
+				files, err := doc.TargetFiles(OutputDir)
+				if err != nil {
+					return err
+				}
+				if err := doc.TrackTargetFiles(OutputDir, files); err != nil {
+					return err
+				}
+				renderedFiles.add(files)
+
+				return nil
+			})
+			if err != nil {
+				logger.Error(err)
+				os.Exit(1)
+			}
+		}
+
+		if reportValueViolations() {
+			os.Exit(1)
+		}
+
+		if err := checkValueFlags(); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		// Files written in an earlier run that are no longer rendered are compared with nothing, their resources are removed
+		staleFiles, err := domain.StaleFiles()
+		if err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+		for _, file := range staleFiles {
+			renderedFiles.add([]domain.RenderedFile{{Path: file}})
+		}
+
+		diffs, err := diffFiles(renderedFiles.files)
+		if err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		err = printDiffs(diffs)
+		if err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		if len(diffs) > 0 {
+			os.Exit(diffExitCode)
+		}
+	},
+}
+
+// renderedFileSet collects rendered files from several configs.
+// Files rendered more than once are concatenated, the same way the template command appends to them.
+type renderedFileSet struct {
+	files []domain.RenderedFile
+	index map[string]int
+}
+
+func (s *renderedFileSet) add(files []domain.RenderedFile) {
+	for _, file := range files {
+		if i, ok := s.index[file.Path]; ok {
+			s.files[i].Content += file.Content
+			continue
+		}
+
+		s.index[file.Path] = len(s.files)
+		s.files = append(s.files, file)
+	}
+}
+
+// diffFiles compares each rendered file with the file on disk.
+// In the semantic and JSON output formats, resources differing only in formatting or comments are left out.
+func diffFiles(files []domain.RenderedFile) ([]domain.ResourceDiff, error) {
+	var result []domain.ResourceDiff
+
+	for _, file := range files {
+		current, err := os.ReadFile(file.Path)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		diffs, err := domain.DiffManifests(file.Path, string(current), file.Content)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, diff := range diffs {
+			if DiffOutput != diffOutputUnified && !diff.IsSemantic() {
+				continue
+			}
+			result = append(result, diff)
+		}
+	}
+
+	return result, nil
+}
+
+// printDiffs prints the diffs in the selected output format.
+func printDiffs(diffs []domain.ResourceDiff) error {
+	switch DiffOutput {
+	case diffOutputJSON:
+		if diffs == nil {
+			diffs = []domain.ResourceDiff{}
+		}
+
+		out, err := json.MarshalIndent(diffs, "", "  ")
+		if err != nil {
+			return fmt.Errorf("error marshaling diff: %w", err)
+		}
+		fmt.Println(string(out))
+
+	case diffOutputSemantic:
+		for _, diff := range diffs {
+			printSemanticDiff(diff)
+		}
+
+	default:
+		for _, diff := range diffs {
+			fmt.Print(diff.UnifiedDiff)
+		}
+	}
+
+	return nil
+}
+
+// printSemanticDiff prints a resource level change followed by its field level changes.
+func printSemanticDiff(diff domain.ResourceDiff) {
+	switch diff.Change {
+	case domain.ResourceAdded:
+		fmt.Printf("+ %v: %v\n", diff.File, diff.Key)
+	case domain.ResourceRemoved:
+		fmt.Printf("- %v: %v\n", diff.File, diff.Key)
+	default:
+		fmt.Printf("~ %v: %v\n", diff.File, diff.Key)
+	}
+
+	for _, field := range diff.Fields {
+		switch field.Type {
+		case "create":
+			fmt.Printf("    + %v: %v\n", field.Path, formatValue(field.To))
+		case "delete":
+			fmt.Printf("    - %v: %v\n", field.Path, formatValue(field.From))
+		default:
+			fmt.Printf("    ~ %v: %v -> %v\n", field.Path, formatValue(field.From), formatValue(field.To))
+		}
+	}
+}
+
+// formatValue formats a field value compactly on a single line.
+func formatValue(value any) string {
+	out, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprintf("%v", value)
+	}
+
+	return string(out)
+}
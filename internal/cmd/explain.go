@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/stefan65535/helmer/internal/domain"
+	"github.com/stefan65535/helmer/internal/logger"
+)
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+	explainCmd.AddCommand(explainValuesCmd)
+	explainValuesCmd.Flags().StringVar(&ExplainChart, "chart", "", "targetDir of the chart to explain the value for. If not set the value is explained for every chart of the config")
+	explainValuesCmd.Flags().BoolVarP(&Verbose, "verbose", "v", false, "enable verbose output")
+	addRenderFlags(explainValuesCmd)
+}
+
+var ExplainChart string
+
+var explainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "Explain how Helmer arrives at its results",
+}
+
+var explainValuesCmd = &cobra.Command{
+	Use:   "values config pointer",
+	Short: "Show where a chart value comes from",
+	Long:  "Show where a chart value comes from. \nThe value at a JSON pointer, e.g. /image/tag, is looked up in every source of chart values in order of precedence: --set-chart, the other value flags, the chart values, the global values of the config and its includes and the chart defaults.\nThe final value is printed along with every source defining it, with file, line and include depth. The source marked with * wins, the others are overridden. Values set by $ref, $file, $files, $env or $sops directives are shown as the directive, local $ref directives are followed",
+	Args:  cobra.ExactArgs(2),
+
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if Verbose {
+			logger.Default.Level = logger.VERBOSE
+		}
+
+		if err := parseValueFlags(); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		doc, err := loadConfig(args[0])
+		if err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		explanations, err := doc.ExplainValue(ExplainChart, args[1])
+		if err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		for i, explanation := range explanations {
+			if i > 0 {
+				fmt.Println()
+			}
+			printValueExplanation(explanation)
+		}
+	},
+}
+
+func printValueExplanation(explanation domain.ValueExplanation) {
+	fmt.Printf("%v (%v) %v\n", explanation.TargetDir, explanation.Chart, explanation.Pointer)
+	if explanation.Found {
+		fmt.Printf("  value: %v\n", formatValue(explanation.Value))
+	} else {
+		fmt.Println("  value: not set")
+	}
+
+	if len(explanation.Candidates) == 0 {
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  \tSOURCE\tLOCATION\tDEPTH\tVALUE")
+	printValueCandidates(w, explanation.Candidates, 1)
+	w.Flush()
+}
+
+func printValueCandidates(w *tabwriter.Writer, candidates []domain.ValueCandidate, indent int) {
+	for _, candidate := range candidates {
+		mark := " "
+		if candidate.Winner {
+			mark = "*"
+		}
+
+		location := candidate.File
+		if candidate.Line > 0 {
+			location = fmt.Sprintf("%v:%v", candidate.File, candidate.Line)
+		}
+		if location == "" {
+			location = "-"
+		}
+
+		value := formatValue(candidate.Value)
+		if candidate.Directive != "" {
+			value = fmt.Sprintf("%v at %v", value, candidate.Directive)
+		}
+
+		fmt.Fprintf(w, "%v%v\t%v\t%v\t%v\t%v\n", strings.Repeat("  ", indent), mark, candidate.Source, location, candidate.Depth, value)
+
+		printValueCandidates(w, candidate.RefChain, indent+1)
+	}
+}
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stefan65535/helmer/internal/domain"
+	"github.com/stefan65535/helmer/internal/logger"
+)
+
+func init() {
+	rootCmd.AddCommand(lockCmd)
+	lockCmd.Flags().StringVar(&LockFile, "lock-file", domain.DefaultLockfile, "lockfile to write")
+	lockCmd.Flags().BoolVarP(&Verbose, "verbose", "v", false, "enable verbose output")
+}
+
+var LockFile string
+var UpdateLock bool
+
+// lockfile is loaded by checkLock on first use. It stays nil if there is no lockfile and it isn't being updated.
+var lockfile *domain.Lockfile
+var lockfileLoaded bool
+
+var lockCmd = &cobra.Command{
+	Use:   "lock config...",
+	Short: "Pin resolved chart versions and digests in a lockfile",
+	Long:  "Pin resolved chart versions and digests in a lockfile. \nEvery chart referenced by the configs and their includes is resolved to an exact version and content digest. Local chart directories are pinned by a hash of their content.\nThe template command refuses to render charts that don't match the lockfile",
+	Args:  cobra.MinimumNArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if Verbose {
+			logger.Default.Level = logger.VERBOSE
+		}
+
+		lockfile = domain.NewLockfile(LockFile)
+		for _, arg := range args {
+			err := walkDir(arg, []string{".yml", ".yaml"}, func(path string) error {
+				doc, err := loadConfig(path)
+				if err != nil {
+					return err
+				}
+
+				lockfile.Update(doc.CollectCharts())
+
+				return nil
+			})
+			if err != nil {
+				logger.Error(err)
+				os.Exit(1)
+			}
+		}
+
+		if err := lockfile.Write(); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// checkLock verifies the charts of a loaded config against the lockfile, or adds them to the lockfile if it is being updated.
+func checkLock(doc *domain.Document) error {
+	if !lockfileLoaded {
+		lockfileLoaded = true
+
+		loaded, err := domain.LoadLockfile(LockFile)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			if UpdateLock {
+				lockfile = domain.NewLockfile(LockFile)
+			}
+		case err != nil:
+			return err
+		default:
+			lockfile = loaded
+		}
+	}
+
+	if lockfile == nil {
+		return nil
+	}
+
+	if UpdateLock {
+		lockfile.Update(doc.CollectCharts())
+
+		return nil
+	}
+
+	if err := lockfile.Verify(doc.CollectCharts()); err != nil {
+		return fmt.Errorf("%w\nRun helmer lock or use --update-lock to update the lockfile", err)
+	}
+
+	return nil
+}
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"fmt"
 	"io/fs"
 	"os"
 	stdpath "path"
@@ -9,16 +10,65 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/stefan65535/helmer/internal/domain"
 	"github.com/stefan65535/helmer/internal/logger"
+	"helm.sh/helm/v4/pkg/cli/values"
+	"helm.sh/helm/v4/pkg/getter"
 )
 
 func init() {
 	rootCmd.AddCommand(templateCmd)
 	templateCmd.Flags().StringVar(&OutputDir, "output-dir", "", "set target root output directory to write rendered templates to. If not set current working directory will be used")
 	templateCmd.Flags().BoolVarP(&Verbose, "verbose", "v", false, "enable verbose output")
+	templateCmd.Flags().StringVar(&LockFile, "lock-file", domain.DefaultLockfile, "lockfile to verify resolved charts against. Verification is skipped if the file doesn't exist")
+	templateCmd.Flags().BoolVar(&UpdateLock, "update-lock", false, "update the lockfile with the resolved charts instead of verifying them")
+	templateCmd.Flags().BoolVar(&Prune, "prune", false, "delete files previously written to the targets by Helmer that are no longer rendered")
+	addRenderFlags(templateCmd)
 }
 
 var OutputDir string
 var Verbose bool
+var Prune bool
+
+var ReleaseName string
+var ReleaseNamespace string
+var KubeVersion string
+var APIVersions []string
+var ValueOptions values.Options
+var ChartValues []string
+
+// addRenderFlags adds the flags overriding the release and capabilities of the configs to a command rendering charts.
+func addRenderFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&ReleaseName, "release-name", "", "release name, overrides the release name set in the configs but not the one set on a chart")
+	cmd.Flags().StringVarP(&ReleaseNamespace, "namespace", "n", "", "release namespace, overrides the release namespace set in the configs but not the one set on a chart")
+	cmd.Flags().StringVar(&KubeVersion, "kube-version", "", "Kubernetes version used for Capabilities.KubeVersion, overrides the kube version set in the configs")
+	cmd.Flags().StringSliceVarP(&APIVersions, "api-versions", "a", nil, "Kubernetes API versions used for Capabilities.APIVersions, overrides the API versions set in the configs. Can be repeated or comma separated")
+	cmd.Flags().StringArrayVarP(&ValueOptions.ValueFiles, "values", "f", nil, "values file for all charts, overrides the values in the configs. Can be repeated")
+	cmd.Flags().StringArrayVar(&ValueOptions.Values, "set", nil, "set values for all charts, overrides the values in the configs. Uses Helm syntax, e.g. key1=val1,key2=val2. Can be repeated")
+	cmd.Flags().StringArrayVar(&ValueOptions.StringValues, "set-string", nil, "set string values for all charts, like --set but values are always strings. Can be repeated")
+	cmd.Flags().StringArrayVar(&ValueOptions.FileValues, "set-file", nil, "set values for all charts from files, e.g. key1=path1,key2=path2. Can be repeated")
+	cmd.Flags().StringArrayVar(&ChartValues, "set-chart", nil, "set values for a single chart, e.g. mychart:key1=val1,key2=val2 where mychart is the targetDir of the chart. Overrides all other values. Can be repeated")
+}
+
+// parseValueFlags sets the values given on the command line as domain.GlobalValueOverrides.
+func parseValueFlags() error {
+	overrides, err := ValueOptions.MergeValues(getter.Providers{})
+	if err != nil {
+		return err
+	}
+
+	chartOverrides, err := domain.ParseChartValues(ChartValues)
+	if err != nil {
+		return err
+	}
+
+	domain.GlobalValueOverrides = domain.ValueOverrides{Values: overrides, Charts: chartOverrides}
+
+	return nil
+}
+
+// checkValueFlags returns an error if values were set for a chart that wasn't rendered, which is most likely a typo.
+func checkValueFlags() error {
+	return domain.GlobalValueOverrides.CheckUnusedCharts()
+}
 
 var templateCmd = &cobra.Command{
 	Use:   "template config...",
@@ -32,6 +82,11 @@ var templateCmd = &cobra.Command{
 			logger.Default.Level = logger.VERBOSE
 		}
 
+		if err := parseValueFlags(); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
 		for _, arg := range args {
 			err := walkDir(arg, []string{".yml", ".yaml"}, processConfig)
 			if err != nil {
@@ -39,48 +94,210 @@ var templateCmd = &cobra.Command{
 				os.Exit(1)
 			}
 		}
+
+		// Checked before anything is written, so a typo doesn't leave files on disk that aren't listed in the indexes
+		if err := checkValueFlags(); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		for _, doc := range renderedConfigs {
+			if err := doc.WriteTarget(OutputDir, Prune); err != nil {
+				logger.Error(err)
+				os.Exit(1)
+			}
+		}
+		for _, file := range domain.UnindexedFiles() {
+			fmt.Fprintf(os.Stderr, "Warning: %v is outside of its target directory, it isn't listed in the index and is never pruned\n", file)
+		}
+
+		if _, err := domain.WriteTargetIndexes(Prune); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		if UpdateLock {
+			if err := lockfile.Write(); err != nil {
+				logger.Error(err)
+				os.Exit(1)
+			}
+		}
+
+		invalidValues := reportValueViolations()
+		if denied := reportPolicyViolations(); denied || invalidValues {
+			os.Exit(1)
+		}
 	},
 }
 
-// processConfig loads a config file at path and writes its targets.
+// policyViolations holds the policy violations of all configs processed, reported at the end of the run.
+var policyViolations []domain.PolicyViolation
+
+// renderedConfigs holds the configs rendered and allowed by their policies, written once all configs are processed.
+var renderedConfigs []*domain.Document
+
+// processConfig loads a config file at path and renders its targets. Targets violating a deny policy are not written.
 func processConfig(path string) error {
+	doc, err := renderConfig(path)
+	if err != nil || doc == nil {
+		return err
+	}
+
+	violations, err := doc.CheckPolicies()
+	if err != nil {
+		return err
+	}
+	policyViolations = append(policyViolations, violations...)
+	if denied(violations) {
+		// Not tracked as written either, so --prune keeps the files the config wrote in earlier runs
+		return nil
+	}
+
+	renderedConfigs = append(renderedConfigs, doc)
+
+	return nil
+}
+
+// denied tells if any of the policy violations has deny severity.
+func denied(violations []domain.PolicyViolation) bool {
+	for _, violation := range violations {
+		if violation.Severity == domain.PolicyDeny {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reportPolicyViolations prints the policy violations of the run and tells if any of them has deny severity.
+func reportPolicyViolations() bool {
+	if len(policyViolations) == 0 {
+		return false
+	}
+
+	fmt.Println("Policy violations:")
+	for _, violation := range policyViolations {
+		fmt.Printf("  %v\n", violation)
+	}
+
+	if denied(policyViolations) {
+		fmt.Println("Targets violating deny policies were not written")
+		return true
+	}
+
+	return false
+}
+
+// renderConfig loads a config file at path and renders its target in memory. If the values of a chart don't match its
+// schema the config isn't rendered and nil is returned, the violations are reported by reportValueViolations.
+func renderConfig(path string) (*domain.Document, error) {
+	doc, err := loadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkLock(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	valid, err := validateValues(path, doc)
+	if err != nil || !valid {
+		return nil, err
+	}
+
+	err = doc.RenderTarget()
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates, err := doc.CheckDuplicates()
+	if err != nil {
+		return nil, err
+	}
+	// Warnings go to stderr to keep the output of diff and validate machine readable
+	for _, duplicate := range duplicates {
+		fmt.Fprintf(os.Stderr, "Warning: %v\n", duplicate)
+	}
+
+	return doc, nil
+}
+
+// valueViolations holds the schema violations of the chart values of all configs processed, reported at the end of the run.
+var valueViolations []string
+
+// validateValues validates the values of all charts of a loaded config against their schemas and tells if they are valid.
+// Violations are collected for reportValueViolations.
+func validateValues(path string, doc *domain.Document) (bool, error) {
+	violations, err := doc.ValidateValues()
+	if err != nil {
+		return false, err
+	}
+
+	for _, violation := range violations {
+		valueViolations = append(valueViolations, fmt.Sprintf("%v: %v", path, violation))
+	}
+
+	return len(violations) == 0, nil
+}
+
+// reportValueViolations prints the schema violations of the chart values of all configs and tells if there were any.
+func reportValueViolations() bool {
+	if len(valueViolations) == 0 {
+		return false
+	}
+
+	fmt.Println("Values don't match the chart schemas:")
+	for _, violation := range valueViolations {
+		fmt.Printf("  %v\n", violation)
+	}
+	fmt.Println("Configs with invalid values were not rendered")
+
+	return true
+}
+
+// loadConfig loads a config file at path with its includes and charts and resolves all value references.
+func loadConfig(path string) (*domain.Document, error) {
 	domain.InitGlobalValues()
 
-	// TODO add option to set from command line
 	domain.GlobalRelease = domain.Release{
 		Name:      "release-name",      // This is the default name Helm uses if none is provided.
 		Namespace: "release-namespace", // This is the default namespace Helm uses if none is provided.
 	}
 
-	// TODO add option to set from command line
 	domain.GlobalCapabilities = domain.Capabilities{}
 
+	domain.GlobalHooks = domain.Hooks{}
+
 	doc, err := domain.LoadDocument(nil, path, 0)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = domain.GlobalValues.ResolveValueRefs()
-	if err != nil {
-		return err
-	}
+	domain.MergeValueOverrides()
 
-	err = doc.ResolveChartValueRefs()
-	if err != nil {
-		return err
+	// Command line flags take precedence over the release and capabilities of the configs
+	if ReleaseName != "" {
+		domain.GlobalRelease.Name = ReleaseName
+	}
+	if ReleaseNamespace != "" {
+		domain.GlobalRelease.Namespace = ReleaseNamespace
+	}
+	if err := domain.OverrideCapabilities(KubeVersion, APIVersions); err != nil {
+		return nil, err
 	}
 
-	err = doc.RenderTarget()
+	err = domain.GlobalValues.ResolveValueRefs()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	err = doc.WriteTarget(OutputDir)
+	err = doc.ResolveChartValueRefs()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	return doc, nil
 }
 
 // walkDir recursivly descends path and calls fileFn on every file with a file extension matching one of the extensions in exts.
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/stefan65535/helmer/internal/domain"
+	"github.com/stefan65535/helmer/internal/logger"
+)
+
+func init() {
+	rootCmd.AddCommand(validateCmd)
+	validateCmd.Flags().StringVar(&SchemaDir, "schema-dir", "", "directory with Kubernetes JSON schemas, in the layout of the kubernetes-json-schema project. If not set only custom resources are validated, against the CRDs in the render")
+	validateCmd.Flags().BoolVarP(&Verbose, "verbose", "v", false, "enable verbose output")
+	validateCmd.Flags().StringVar(&LockFile, "lock-file", domain.DefaultLockfile, "lockfile to verify resolved charts against. Verification is skipped if the file doesn't exist")
+	addRenderFlags(validateCmd)
+}
+
+var SchemaDir string
+
+var validateCmd = &cobra.Command{
+	Use:   "validate config...",
+	Short: "Validate rendered resources against Kubernetes schemas",
+	Long:  "Validate rendered resources against Kubernetes schemas. \nTargets are rendered in memory exactly as with the template command and every resource is validated offline against the JSON schema of its kind. Schemas of built-in kinds are read from --schema-dir for the kube version of the capabilities, e.g. <schema-dir>/v1.33.0-standalone-strict/deployment-apps-v1.json as published by the kubernetes-json-schema project. Custom resources are validated against the CRDs rendered in the same target. Nothing is written.\nExits with code 1 if any resource doesn't validate",
+	Args:  cobra.MinimumNArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if Verbose {
+			logger.Default.Level = logger.VERBOSE
+		}
+
+		if err := parseValueFlags(); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		var violations []domain.ManifestViolation
+		for _, arg := range args {
+			err := walkDir(arg, []string{".yml", ".yaml"}, func(path string) error {
+				doc, err := renderConfig(path)
+				if err != nil || doc == nil {
+					return err
+				}
+
+				docViolations, err := doc.ValidateManifests(SchemaDir)
+				if err != nil {
+					return err
+				}
+				violations = append(violations, docViolations...)
+
+				return nil
+			})
+			if err != nil {
+				logger.Error(err)
+				os.Exit(1)
+			}
+		}
+
+		if reportValueViolations() {
+			os.Exit(1)
+		}
+
+		if err := checkValueFlags(); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		for _, violation := range violations {
+			fmt.Println(violation)
+		}
+		if len(violations) > 0 {
+			os.Exit(1)
+		}
+	},
+}
@@ -0,0 +1,94 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/goccy/go-yaml"
+	"github.com/spf13/cobra"
+	"github.com/stefan65535/helmer/internal/domain"
+	"github.com/stefan65535/helmer/internal/logger"
+)
+
+func init() {
+	rootCmd.AddCommand(valuesCmd)
+	valuesCmd.Flags().StringVar(&ValuesChart, "chart", "", "targetDir of the chart to print the values of. If not set the values of every chart of the config are printed")
+	valuesCmd.Flags().BoolVar(&ValuesWithDefaults, "with-defaults", false, "merge the values with the chart defaults, as Helm does when rendering")
+	valuesCmd.Flags().StringVarP(&ValuesOutput, "output", "o", valuesOutputYAML, "output format. One of: yaml, json")
+	valuesCmd.Flags().BoolVarP(&Verbose, "verbose", "v", false, "enable verbose output")
+	addRenderFlags(valuesCmd)
+}
+
+var ValuesChart string
+var ValuesWithDefaults bool
+var ValuesOutput string
+
+const (
+	valuesOutputYAML = "yaml"
+	valuesOutputJSON = "json"
+)
+
+var valuesCmd = &cobra.Command{
+	Use:   "values config",
+	Short: "Print the values charts are rendered with",
+	Long:  "Print the values charts are rendered with. \nThe values are the global values of the config and its includes merged with the chart values and the values given on the command line, with all directives resolved and .Values.Helmer set, exactly as passed to Helm. Nothing is rendered",
+	Args:  cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+
+		if Verbose {
+			logger.Default.Level = logger.VERBOSE
+		}
+
+		if ValuesOutput != valuesOutputYAML && ValuesOutput != valuesOutputJSON {
+			logger.Error(fmt.Errorf("unknown output format %v", ValuesOutput))
+			os.Exit(1)
+		}
+
+		if err := parseValueFlags(); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		doc, err := loadConfig(args[0])
+		if err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		chartValues, err := doc.ChartValues(ValuesChart, ValuesWithDefaults)
+		if err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+
+		if err := printChartValues(chartValues); err != nil {
+			logger.Error(err)
+			os.Exit(1)
+		}
+	},
+}
+
+// printChartValues prints the values of each chart as a YAML document, or all charts as a JSON array.
+func printChartValues(chartValues []domain.ChartValues) error {
+	if ValuesOutput == valuesOutputJSON {
+		out, err := json.MarshalIndent(chartValues, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(out))
+
+		return nil
+	}
+
+	for _, values := range chartValues {
+		out, err := yaml.Marshal(values.Values)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("---\n# Chart: %v\n# TargetDir: %v\n%s", values.Chart, values.TargetDir, out)
+	}
+
+	return nil
+}
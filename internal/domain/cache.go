@@ -0,0 +1,297 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// ChartCache is a content-addressed store of chart archives on disk, shared between runs.
+// Archives are stored by their sha256 digest. Other digests identifying the same content, like the
+// digest of an OCI manifest, can be registered as aliases.
+type ChartCache struct {
+	Dir string // Cache directory. If not set DefaultCacheDir is used.
+}
+
+var GlobalChartCache ChartCache
+
+// CachedChart describes a chart archive in the cache.
+type CachedChart struct {
+	Digest   string    `json:"digest"`
+	Name     string    `json:"name"`
+	Version  string    `json:"version"`
+	Source   string    `json:"source"` // Reference the chart was fetched from
+	Size     int64     `json:"-"`
+	LastUsed time.Time `json:"-"`
+}
+
+// cacheDirEnv can be set to override the default cache directory.
+const cacheDirEnv = "HELMER_CACHE_DIR"
+
+var sha256Digest = regexp.MustCompile(`^sha256:([a-f0-9]{64})$`)
+
+// DefaultCacheDir returns the cache directory used if none is configured.
+// It is $HELMER_CACHE_DIR if set, otherwise helmer in the user cache directory, $XDG_CACHE_HOME on Linux.
+func DefaultCacheDir() (string, error) {
+	if dir := os.Getenv(cacheDirEnv); dir != "" {
+		return dir, nil
+	}
+
+	userCacheDir, err := os.UserCacheDir()
+	if err != nil {
+		return "", fmt.Errorf("unable to determine cache directory, set --cache-dir or %v: %w", cacheDirEnv, err)
+	}
+
+	return filepath.Join(userCacheDir, "helmer"), nil
+}
+
+func (c *ChartCache) dir() (string, error) {
+	if c.Dir != "" {
+		return c.Dir, nil
+	}
+
+	return DefaultCacheDir()
+}
+
+// paths returns the archive, metadata and alias file paths for a digest.
+func (c *ChartCache) paths(digest string) (archive string, meta string, alias string, err error) {
+	dir, err := c.dir()
+	if err != nil {
+		return "", "", "", err
+	}
+
+	match := sha256Digest.FindStringSubmatch(digest)
+	if match == nil {
+		return "", "", "", fmt.Errorf("unsupported digest %q, only sha256 digests are supported", digest)
+	}
+
+	return filepath.Join(dir, "charts", match[1]+".tgz"),
+		filepath.Join(dir, "charts", match[1]+".json"),
+		filepath.Join(dir, "refs", match[1]),
+		nil
+}
+
+// Get returns the archive with the given digest, or the archive the digest is an alias for.
+// The archive content is verified against its digest, a corrupt entry is treated as missing.
+func (c *ChartCache) Get(digest string) ([]byte, bool, error) {
+	archivePath, _, aliasPath, err := c.paths(digest)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if target, err := os.ReadFile(aliasPath); err == nil {
+		digest = strings.TrimSpace(string(target))
+		archivePath, _, _, err = c.paths(digest)
+		if err != nil {
+			return nil, false, err
+		}
+	}
+
+	archive, err := os.ReadFile(archivePath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	if digestOf(archive) != digest {
+		return nil, false, nil
+	}
+
+	// The modification time tracks when the entry was last used, for pruning
+	now := time.Now()
+	_ = os.Chtimes(archivePath, now, now)
+
+	return archive, true, nil
+}
+
+// Put stores an archive along with a description of it and returns the archive digest.
+// Aliases are additional digests the archive can be looked up by.
+func (c *ChartCache) Put(archive []byte, chart CachedChart, aliases ...string) (string, error) {
+	digest := digestOf(archive)
+	chart.Digest = digest
+
+	archivePath, metaPath, _, err := c.paths(digest)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(archivePath), 0755); err != nil {
+		return "", err
+	}
+
+	meta, err := json.Marshal(chart)
+	if err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(metaPath, meta); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(archivePath, archive); err != nil {
+		return "", err
+	}
+
+	for _, alias := range aliases {
+		_, _, aliasPath, err := c.paths(alias)
+		if err != nil {
+			return "", err
+		}
+		if err := os.MkdirAll(filepath.Dir(aliasPath), 0755); err != nil {
+			return "", err
+		}
+		if err := writeFileAtomic(aliasPath, []byte(digest)); err != nil {
+			return "", err
+		}
+	}
+
+	return digest, nil
+}
+
+// List returns all charts in the cache, most recently used first.
+func (c *ChartCache) List() ([]CachedChart, error) {
+	dir, err := c.dir()
+	if err != nil {
+		return nil, err
+	}
+
+	archives, err := filepath.Glob(filepath.Join(dir, "charts", "*.tgz"))
+	if err != nil {
+		return nil, err
+	}
+
+	var charts []CachedChart
+	for _, archivePath := range archives {
+		info, err := os.Stat(archivePath)
+		if err != nil {
+			return nil, err
+		}
+
+		chart := CachedChart{Digest: "sha256:" + strings.TrimSuffix(filepath.Base(archivePath), ".tgz")}
+		if meta, err := os.ReadFile(strings.TrimSuffix(archivePath, ".tgz") + ".json"); err == nil {
+			_ = json.Unmarshal(meta, &chart)
+		}
+		chart.Size = info.Size()
+		chart.LastUsed = info.ModTime()
+
+		charts = append(charts, chart)
+	}
+
+	slices.SortFunc(charts, func(a, b CachedChart) int {
+		return b.LastUsed.Compare(a.LastUsed)
+	})
+
+	return charts, nil
+}
+
+// Prune removes charts that haven't been used since before the given time, and aliases pointing to removed charts.
+func (c *ChartCache) Prune(unusedSince time.Time) ([]CachedChart, error) {
+	charts, err := c.List()
+	if err != nil {
+		return nil, err
+	}
+
+	var pruned []CachedChart
+	for _, chart := range charts {
+		if !chart.LastUsed.Before(unusedSince) {
+			continue
+		}
+
+		archivePath, metaPath, _, err := c.paths(chart.Digest)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Remove(archivePath); err != nil {
+			return nil, err
+		}
+		if err := os.Remove(metaPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+
+		pruned = append(pruned, chart)
+	}
+
+	dir, err := c.dir()
+	if err != nil {
+		return nil, err
+	}
+
+	aliases, err := filepath.Glob(filepath.Join(dir, "refs", "*"))
+	if err != nil {
+		return nil, err
+	}
+	for _, aliasPath := range aliases {
+		target, err := os.ReadFile(aliasPath)
+		if err != nil {
+			return nil, err
+		}
+
+		archivePath, _, _, err := c.paths(strings.TrimSpace(string(target)))
+		if err == nil {
+			if _, err := os.Stat(archivePath); err == nil {
+				continue
+			}
+		}
+
+		if err := os.Remove(aliasPath); err != nil {
+			return nil, err
+		}
+	}
+
+	return pruned, nil
+}
+
+// Clear removes all charts from the cache.
+func (c *ChartCache) Clear() error {
+	dir, err := c.dir()
+	if err != nil {
+		return err
+	}
+
+	for _, subDir := range []string{"charts", "refs"} {
+		if err := os.RemoveAll(filepath.Join(dir, subDir)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// digestOf returns the sha256 digest of data formatted as "sha256:<hex>".
+func digestOf(data []byte) string {
+	sum := sha256.Sum256(data)
+
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// writeFileAtomic writes a file via a temporary file so concurrent runs never see a partially written file.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(0644); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,67 @@
+package domain
+
+import (
+	"testing"
+	"time"
+)
+
+// useChartCache points the chart cache to an empty directory for the duration of a test.
+func useChartCache(t *testing.T) {
+	t.Helper()
+
+	previous := GlobalChartCache
+	GlobalChartCache = ChartCache{Dir: t.TempDir()}
+	t.Cleanup(func() {
+		GlobalChartCache = previous
+	})
+}
+
+func TestChartCache(t *testing.T) {
+	useChartCache(t)
+
+	archive := []byte("chart archive")
+	alias := digestOf([]byte("manifest"))
+
+	digest, err := GlobalChartCache.Put(archive, CachedChart{Name: "mychart", Version: "1.2.3"}, alias)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, d := range []string{digest, alias} {
+		cached, ok, err := GlobalChartCache.Get(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ok || string(cached) != string(archive) {
+			t.Errorf("expected archive to be found by %v", d)
+		}
+	}
+
+	charts, err := GlobalChartCache.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(charts) != 1 || charts[0].Name != "mychart" || charts[0].Digest != digest {
+		t.Fatalf("unexpected cache content %+v", charts)
+	}
+
+	pruned, err := GlobalChartCache.Prune(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 0 {
+		t.Errorf("expected recently used chart to be kept, pruned %+v", pruned)
+	}
+
+	pruned, err = GlobalChartCache.Prune(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) != 1 {
+		t.Errorf("expected chart to be pruned, pruned %+v", pruned)
+	}
+
+	if _, ok, _ := GlobalChartCache.Get(alias); ok {
+		t.Error("expected alias to be pruned along with the chart")
+	}
+}
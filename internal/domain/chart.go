@@ -3,29 +3,49 @@ package domain
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"os"
 	stdpath "path"
 	"path/filepath"
+	"strings"
 	"text/template"
 
+	"github.com/stefan65535/helmer/internal/logger"
 	"github.com/stefan65535/helmer/internal/utils"
 	"helm.sh/helm/v4/pkg/action"
 	"helm.sh/helm/v4/pkg/chart"
-	"helm.sh/helm/v4/pkg/chart/common"
 	"helm.sh/helm/v4/pkg/chart/loader"
+	"helm.sh/helm/v4/pkg/registry"
 
 	releasev1 "helm.sh/helm/v4/pkg/release/v1"
 )
 
 type Chart struct {
-	Path         string      `yaml:"path"`
+	Path         string      `yaml:"path,omitempty"`
+	Repo         string      `yaml:"repo,omitempty"`
+	Name         string      `yaml:"name,omitempty"`
+	Version      string      `yaml:"version,omitempty"`
 	Patches      []*Patch    `yaml:"patches"`
 	Values       Values      `yaml:"values"`
 	Release      Release     `yaml:"release,omitempty"`
 	TargetDir    string      `yaml:"targetDir,omitempty"`
 	AuxTemplates []*Template `yaml:"auxTemplates,omitempty"`
+	Hooks        Hooks       `yaml:"hooks,omitempty"`
+	CRDs         string      `yaml:"crds,omitempty"`
+	CRDsDir      string      `yaml:"crdsDir,omitempty"`
+	Policies     []*Policy   `yaml:"policies,omitempty"`
+
+	resolved    *resolvedChart
+	valueSource *valueSource // Where the chart values were defined
+	config      string       // Path to the config file the chart is declared in
+}
 
+// resolvedChart is what a chart reference resolved to when it was loaded.
+type resolvedChart struct {
 	charter chart.Charter
+	source  string // Absolute path for local charts, chart reference for remote charts
+	version string // Chart version
+	digest  string // Content digest of the chart
 }
 
 type Template struct {
@@ -40,39 +60,45 @@ type RenderedChart struct {
 	Manifests []string
 }
 
-// TODO chash charts instead of charters? Charts are what we load from disk and render, charters are what Helm uses to render. Charts could also include the loaded charter and rendered release to avoid having to pass them around
-var charterCash = make(map[string]chart.Charter)
+// resolvedCharts holds the charts resolved by this process, keyed by absolute path for local charts and by chart reference for remote charts.
+// It saves resolving the same reference more than once when it is used by several configs. Remote chart content is kept in the persistent GlobalChartCache.
+var resolvedCharts = make(map[string]*resolvedChart)
 
-func (c *Chart) load(configPath string) error {
-	if c.charter == nil {
-		absPath, err := filepath.Abs(stdpath.Join(configPath, c.Path))
-		if err != nil {
-			return err
+// String returns a human readable reference to the chart source.
+func (c *Chart) String() string {
+	if c.Repo != "" {
+		if c.Version != "" {
+			return fmt.Sprintf("%v/%v@%v", strings.TrimSuffix(c.Repo, "/"), c.Name, c.Version)
 		}
+		return fmt.Sprintf("%v/%v", strings.TrimSuffix(c.Repo, "/"), c.Name)
+	}
 
-		var charter chart.Charter
-
-		// Try to get the charter from cache
-		if cachedCharter, ok := charterCash[absPath]; ok {
-			charter = cachedCharter
-		} else {
-			loader, err := loader.Loader(absPath)
-			if err != nil {
-				return err
-			}
+	if registry.IsOCI(c.Path) && c.Version != "" {
+		return fmt.Sprintf("%v:%v", c.Path, c.Version)
+	}
 
-			charter, err = loader.Load()
-			if err != nil {
-				return err
-			}
+	return c.Path
+}
 
-			charterCash[absPath] = charter
+func (c *Chart) load(configPath string, indent int) error {
+	if c.resolved == nil {
+		var err error
+
+		switch {
+		case c.Repo != "":
+			c.resolved, err = c.loadFromRepo(indent)
+		case registry.IsOCI(c.Path):
+			c.resolved, err = c.loadFromOCI(indent)
+		default:
+			c.resolved, err = c.loadFromPath(configPath)
+		}
+		if err != nil {
+			return err
 		}
-		c.charter = charter
 	}
 
 	if c.TargetDir == "" {
-		accessor, err := chart.NewAccessor(c.charter)
+		accessor, err := chart.NewAccessor(c.resolved.charter)
 		if err != nil {
 			return err
 		}
@@ -80,6 +106,10 @@ func (c *Chart) load(configPath string) error {
 		c.TargetDir = accessor.Name()
 	}
 
+	if c.CRDsDir == "" {
+		c.CRDsDir = c.TargetDir + "-crds"
+	}
+
 	for _, auxTemplate := range c.AuxTemplates {
 		auxAbsPath, err := filepath.Abs(stdpath.Join(configPath, auxTemplate.Path))
 		if err != nil {
@@ -97,21 +127,140 @@ func (c *Chart) load(configPath string) error {
 	return nil
 }
 
-func (c *Chart) render() (*releasev1.Release, error) {
-	if c.charter == nil {
-		return nil, errors.New("chart not loaded")
+// loadFromPath loads a chart from a local directory or archive relative to configPath.
+func (c *Chart) loadFromPath(configPath string) (*resolvedChart, error) {
+	if c.Path == "" {
+		return nil, errors.New("chart must have either a path or a repo")
+	}
+	if c.Name != "" || c.Version != "" {
+		return nil, fmt.Errorf("chart %v: name and version are only supported for repo and oci charts", c.Path)
 	}
 
-	cfg := action.Configuration{}
-	cfg.Capabilities = common.DefaultCapabilities
+	absPath, err := filepath.Abs(stdpath.Join(configPath, c.Path))
+	if err != nil {
+		return nil, err
+	}
+
+	// Try to get the charter from cache
+	if cachedChart, ok := resolvedCharts[absPath]; ok {
+		return cachedChart, nil
+	}
+
+	loader, err := loader.Loader(absPath)
+	if err != nil {
+		return nil, err
+	}
 
-	cfg.Capabilities.APIVersions = GlobalCapabilities.APIVersions
-	cfg.Capabilities.KubeVersion.Version = GlobalCapabilities.KubeVersion.Version
-	cfg.Capabilities.KubeVersion.Major = GlobalCapabilities.KubeVersion.Major
-	cfg.Capabilities.KubeVersion.Minor = GlobalCapabilities.KubeVersion.Minor
+	charter, err := loader.Load()
+	if err != nil {
+		return nil, err
+	}
+
+	digest, err := utils.HashPath(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("error hashing chart %v: %w", absPath, err)
+	}
+
+	resolved := &resolvedChart{charter: charter, source: absPath, version: charterVersion(charter), digest: digest}
+	resolvedCharts[absPath] = resolved
+
+	return resolved, nil
+}
+
+// loadFromRepo fetches a chart from a Helm chart repository.
+func (c *Chart) loadFromRepo(indent int) (*resolvedChart, error) {
+	if c.Path != "" {
+		return nil, fmt.Errorf("chart %v: path and repo can't be used together", c.Path)
+	}
+	if c.Name == "" {
+		return nil, fmt.Errorf("chart from repo %v must have a name", c.Repo)
+	}
+
+	cacheKey := c.String()
+
+	// Try to get the charter from cache
+	if cachedChart, ok := resolvedCharts[cacheKey]; ok {
+		return cachedChart, nil
+	}
+
+	charter, chartVersion, digest, err := fetchRepoChart(c.Repo, c.Name, c.Version, indent)
+	if err != nil {
+		return nil, err
+	}
+	logger.Verbosef(indent, "Resolved chart %v to version %v", c, chartVersion.Version)
+
+	resolved := &resolvedChart{charter: charter, source: cacheKey, version: chartVersion.Version, digest: digest}
+	resolvedCharts[cacheKey] = resolved
+
+	return resolved, nil
+}
+
+// loadFromOCI pulls a chart from an OCI registry.
+func (c *Chart) loadFromOCI(indent int) (*resolvedChart, error) {
+	if c.Name != "" {
+		return nil, fmt.Errorf("chart %v: name is not supported for oci charts, the chart name is part of the path", c.Path)
+	}
+
+	cacheKey := c.String()
+
+	// Try to get the charter from cache
+	if cachedChart, ok := resolvedCharts[cacheKey]; ok {
+		return cachedChart, nil
+	}
+
+	charter, digest, err := pullOCIChart(c.Path, c.Version, indent)
+	if err != nil {
+		return nil, err
+	}
+	logger.Verbosef(indent, "Resolved chart %v to digest %v", c, digest)
+
+	resolved := &resolvedChart{charter: charter, source: cacheKey, version: charterVersion(charter), digest: digest}
+	resolvedCharts[cacheKey] = resolved
+
+	return resolved, nil
+}
+
+// charterVersion returns the version from the chart metadata.
+func charterVersion(charter chart.Charter) string {
+	accessor, err := chart.NewAccessor(charter)
+	if err != nil {
+		return ""
+	}
+
+	if version, ok := accessor.MetadataAsMap()["Version"].(string); ok {
+		return version
+	}
+
+	return ""
+}
+
+func (c *Chart) render() (RenderedRelease, error) {
+	if c.resolved == nil {
+		return RenderedRelease{}, errors.New("chart not loaded")
+	}
+
+	hooks := GlobalHooks.override(c.Hooks)
+	hooksPolicy, err := hooks.policy()
+	if err != nil {
+		return RenderedRelease{}, fmt.Errorf("chart %v: %w", c, err)
+	}
+
+	crdsPolicy, err := checkCRDsPolicy(c.CRDs)
+	if err != nil {
+		return RenderedRelease{}, fmt.Errorf("chart %v: %w", c, err)
+	}
+
+	kubeVersion, err := GlobalCapabilities.KubeVersion.helmKubeVersion()
+	if err != nil {
+		return RenderedRelease{}, err
+	}
+
+	cfg := action.Configuration{}
 
 	install := action.NewInstall(&cfg)
 	install.DryRunStrategy = action.DryRunClient
+	install.KubeVersion = kubeVersion
+	install.APIVersions = GlobalCapabilities.APIVersions // Like helm template --api-versions, these are added to the default API versions
 	if c.Release.Name != "" {
 		install.ReleaseName = c.Release.Name
 	} else {
@@ -123,22 +272,56 @@ func (c *Chart) render() (*releasev1.Release, error) {
 		install.Namespace = GlobalRelease.Namespace
 	}
 
-	values := utils.MergeMaps(GlobalValues, c.Values)
+	values := GlobalValueOverrides.chartValues(c)
 
-	releaser, err := install.Run(c.charter, values)
+	releaser, err := install.Run(c.resolved.charter, values)
 	if err != nil {
-		return nil, err
+		return RenderedRelease{}, err
 	}
 
 	release := releaser.(*releasev1.Release) // Helm does not provide any public help to deal with Releaser. releaserToV1Release exists in get_values.go but it's a private function.
+	rendered := RenderedRelease{Release: release, TargetDir: c.TargetDir, CRDsDir: c.CRDsDir, chart: c}
 
-	if err = applyPatches(release, c.Patches, values); err != nil {
-		return nil, err
+	if crdsPolicy != CRDsSkip {
+		crdsManifest, err := renderCRDs(c.resolved.charter)
+		if err != nil {
+			return RenderedRelease{}, fmt.Errorf("chart %v: %w", c, err)
+		}
+
+		if crdsPolicy == CRDsInclude {
+			release.Manifest = crdsManifest + release.Manifest
+		} else {
+			rendered.CRDsManifest, err = applyPatches(crdsManifest, c.Patches, values)
+			if err != nil {
+				return RenderedRelease{}, fmt.Errorf("chart %v: %w", c, err)
+			}
+		}
+	}
+
+	if hooksPolicy != HooksExclude {
+		hooksManifest, err := renderHooks(release.Hooks, hooks)
+		if err != nil {
+			return RenderedRelease{}, err
+		}
+
+		if hooksPolicy == HooksInclude {
+			release.Manifest = release.Manifest + hooksManifest
+		} else {
+			rendered.HooksManifest, err = applyPatches(hooksManifest, c.Patches, values)
+			if err != nil {
+				return RenderedRelease{}, fmt.Errorf("chart %v: %w", c, err)
+			}
+		}
+	}
+
+	release.Manifest, err = applyPatches(release.Manifest, c.Patches, values)
+	if err != nil {
+		return RenderedRelease{}, fmt.Errorf("chart %v: %w", c, err)
 	}
 
 	renderedAuxTemplates, err := c.renderAuxTemplates(values)
 	if err != nil {
-		return nil, err
+		return RenderedRelease{}, err
 	}
 
 	for _, auxManifest := range renderedAuxTemplates {
@@ -146,11 +329,12 @@ func (c *Chart) render() (*releasev1.Release, error) {
 		release.Manifest = release.Manifest + string(auxManifest)
 	}
 
-	return release, nil
+	return rendered, nil
 }
 
-func (c *Chart) renderAuxTemplates(values map[string]any) (map[string][]byte, error) {
-	renderedAuxTemplates := make(map[string][]byte)
+// renderAuxTemplates renders the aux templates of the chart in the order they are declared.
+func (c *Chart) renderAuxTemplates(values map[string]any) ([][]byte, error) {
+	var renderedAuxTemplates [][]byte
 
 	for _, auxTemplate := range c.AuxTemplates {
 		localValues := utils.MergeMaps(values, auxTemplate.Values)
@@ -170,24 +354,24 @@ func (c *Chart) renderAuxTemplates(values map[string]any) (map[string][]byte, er
 			return nil, err
 		}
 
-		renderedAuxTemplates[auxTemplate.Path] = rendered.Bytes()
+		renderedAuxTemplates = append(renderedAuxTemplates, rendered.Bytes())
 	}
 
 	return renderedAuxTemplates, nil
 }
 
-func applyPatches(release *releasev1.Release, patches []*Patch, values map[string]any) error {
-	if len(patches) == 0 {
-		return nil
-	}
-
-	for _, patch := range patches {
-		newManifest, err := patch.Apply(release.Manifest, values)
+func applyPatches(manifests string, patches []*Patch, values map[string]any) (string, error) {
+	for i, patch := range patches {
+		newManifests, err := patch.Apply(manifests, values)
 		if err != nil {
-			return err
+			name := patch.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+			return "", fmt.Errorf("patch %v: %w", name, err)
 		}
-		release.Manifest = newManifest
+		manifests = newManifests
 	}
 
-	return nil
+	return manifests, nil
 }
@@ -0,0 +1,43 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"helm.sh/helm/v4/pkg/chart"
+	chartv2 "helm.sh/helm/v4/pkg/chart/v2"
+)
+
+// CRD policies
+const (
+	CRDsSkip        = "skip"        // CRDs are dropped. This is the default.
+	CRDsInclude     = "include"     // CRDs are written ahead of the other manifests of the chart.
+	CRDsSeparateDir = "separateDir" // CRDs are written to a target directory of their own.
+)
+
+func checkCRDsPolicy(policy string) (string, error) {
+	switch policy {
+	case "":
+		return CRDsSkip, nil
+	case CRDsSkip, CRDsInclude, CRDsSeparateDir:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown crds policy %q, must be one of %v, %v or %v", policy, CRDsSkip, CRDsInclude, CRDsSeparateDir)
+	}
+}
+
+// renderCRDs renders the CRDs in the crds/ directories of a chart and its subcharts as a multi document manifest,
+// the same way helm template --include-crds does.
+func renderCRDs(charter chart.Charter) (string, error) {
+	ch, ok := charter.(*chartv2.Chart)
+	if !ok {
+		return "", fmt.Errorf("unsupported chart type %T", charter)
+	}
+
+	var result strings.Builder
+	for _, crd := range ch.CRDObjects() {
+		fmt.Fprintf(&result, "---\n# Source: %v\n%v\n", crd.Filename, strings.TrimRight(string(crd.File.Data), "\n"))
+	}
+
+	return result.String(), nil
+}
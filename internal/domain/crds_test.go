@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+const widgetCRD = `apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+`
+
+func TestRenderCRDs(t *testing.T) {
+	c := Chart{}
+	localChart(t, &c, map[string]string{
+		"crds/widgets.yaml":            widgetCRD,
+		"charts/sub/Chart.yaml":        "apiVersion: v2\nname: sub\nversion: 1.0.0\n",
+		"charts/sub/crds/gadgets.yaml": "apiVersion: apiextensions.k8s.io/v1\nkind: CustomResourceDefinition\nmetadata:\n  name: gadgets.example.com\n",
+	})
+
+	manifest, err := renderCRDs(c.resolved.charter)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// CRDs of subcharts are included, each with the path of its file as source
+	for _, expected := range []string{
+		"---\n# Source: app/crds/widgets.yaml\n" + widgetCRD,
+		"---\n# Source: app/charts/sub/crds/gadgets.yaml\n",
+	} {
+		if !strings.Contains(manifest, expected) {
+			t.Errorf("expected manifest to contain\n%v\ngot\n%v", expected, manifest)
+		}
+	}
+}
+
+func TestChartRenderCRDsPolicy(t *testing.T) {
+	files := map[string]string{
+		"crds/widgets.yaml":      widgetCRD,
+		"templates/service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: app\n",
+	}
+	patches := []*Patch{{
+		Target: PatchTarget{Kind: "CustomResourceDefinition"},
+		Merge:  map[string]any{"metadata": map[string]any{"labels": map[string]any{"patched": "true"}}},
+	}}
+
+	for _, test := range []struct {
+		policy     string
+		crdsDir    string
+		inManifest bool   // The CRD is part of the manifest of the chart
+		crdsFile   string // File the CRD is written to, if written separately
+	}{
+		{"", "", false, ""},
+		{CRDsSkip, "", false, ""},
+		{CRDsInclude, "", true, ""},
+		{CRDsSeparateDir, "", false, "out/prod/app-crds/manifest.yaml"},
+		{CRDsSeparateDir, "crds", false, "out/prod/crds/manifest.yaml"},
+	} {
+		c := Chart{Release: Release{Name: "app"}, CRDs: test.policy, CRDsDir: test.crdsDir, Patches: patches}
+		localChart(t, &c, files)
+
+		rendered, err := c.render()
+		if err != nil {
+			t.Errorf("policy %q: %v", test.policy, err)
+			continue
+		}
+
+		if strings.Contains(rendered.Release.Manifest, "widgets.example.com") != test.inManifest {
+			t.Errorf("policy %q: expected CRD in manifest %v, got\n%v", test.policy, test.inManifest, rendered.Release.Manifest)
+		}
+
+		target := Target{Path: "prod"}
+		target.renderedReleases = []RenderedRelease{rendered}
+		targetFiles, err := target.Files("out")
+		if err != nil {
+			t.Errorf("policy %q: %v", test.policy, err)
+			continue
+		}
+
+		var crdsContent string
+		var paths []string
+		for _, file := range targetFiles {
+			paths = append(paths, file.Path)
+			if strings.Contains(file.Content, "widgets.example.com") {
+				crdsContent = file.Content
+				if test.crdsFile != "" && file.Path != test.crdsFile {
+					t.Errorf("policy %q: expected CRD in %v, got %v", test.policy, test.crdsFile, file.Path)
+				}
+			}
+		}
+		if test.crdsFile != "" && len(paths) != 2 {
+			t.Errorf("policy %q: expected the manifest and %v, got %v", test.policy, test.crdsFile, paths)
+		}
+
+		if test.policy == CRDsSkip || test.policy == "" {
+			if crdsContent != "" {
+				t.Errorf("policy %q: expected CRD to be skipped, got\n%v", test.policy, crdsContent)
+			}
+			continue
+		}
+		if !strings.Contains(crdsContent, "patched: \"true\"") {
+			t.Errorf("policy %q: expected patch to be applied to the CRD, got\n%v", test.policy, crdsContent)
+		}
+	}
+
+	c := Chart{Release: Release{Name: "app"}, CRDs: "separate"}
+	localChart(t, &c, files)
+	if _, err := c.render(); err == nil {
+		t.Error("expected error for unknown crds policy")
+	}
+}
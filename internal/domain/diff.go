@@ -0,0 +1,215 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pmezard/go-difflib/difflib"
+	"github.com/r3labs/diff/v3"
+)
+
+// ResourceKey identifies a Kubernetes resource within a manifest file.
+type ResourceKey struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Namespace  string `json:"namespace,omitempty"`
+	Name       string `json:"name"`
+}
+
+func (k ResourceKey) String() string {
+	if k.Namespace == "" {
+		return fmt.Sprintf("%v %v %v", k.APIVersion, k.Kind, k.Name)
+	}
+
+	return fmt.Sprintf("%v %v %v/%v", k.APIVersion, k.Kind, k.Namespace, k.Name)
+}
+
+// ChangeType tells how a resource differs between the current and the rendered content of a file.
+type ChangeType string
+
+const (
+	ResourceAdded   ChangeType = "added"
+	ResourceRemoved ChangeType = "removed"
+	ResourceChanged ChangeType = "changed"
+)
+
+// FieldChange is a change of a single field within a resource.
+type FieldChange struct {
+	Path string `json:"path"` // JSON pointer to the field
+	Type string `json:"type"` // create, update or delete
+	From any    `json:"from,omitempty"`
+	To   any    `json:"to,omitempty"`
+}
+
+// ResourceDiff is the difference of a single resource between the current and the rendered content of a file.
+type ResourceDiff struct {
+	File        string        `json:"file"`
+	Key         ResourceKey   `json:"resource"`
+	Change      ChangeType    `json:"change"`
+	Fields      []FieldChange `json:"fields,omitempty"`
+	UnifiedDiff string        `json:"-"`
+}
+
+// IsSemantic reports whether the resource differs in content and not only in formatting, comments or document order.
+func (d ResourceDiff) IsSemantic() bool {
+	return d.Change != ResourceChanged || len(d.Fields) > 0
+}
+
+// resourceDocument is a single YAML document of a manifest file together with its identity.
+type resourceDocument struct {
+	key      ResourceKey
+	id       string // key made unique within the file, in case the same resource occurs more than once
+	content  string
+	manifest map[string]any
+}
+
+// DiffManifests compares the current content of a manifest file with freshly rendered content and returns
+// the difference for each resource that differs. Resources are matched by apiVersion, kind, namespace and name,
+// so the order of documents in the file does not matter.
+func DiffManifests(fileName string, current string, rendered string) ([]ResourceDiff, error) {
+	currentDocs, err := parseResourceDocuments(current)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %v:\n%w", fileName, err)
+	}
+
+	renderedDocs, err := parseResourceDocuments(rendered)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing rendered content for %v:\n%w", fileName, err)
+	}
+
+	currentByID := make(map[string]resourceDocument, len(currentDocs))
+	for _, doc := range currentDocs {
+		currentByID[doc.id] = doc
+	}
+
+	var diffs []ResourceDiff
+	seen := make(map[string]bool, len(renderedDocs))
+	for _, doc := range renderedDocs {
+		seen[doc.id] = true
+
+		currentDoc, exists := currentByID[doc.id]
+
+		unified, err := unifiedDiff(fileName, doc.key, currentDoc.content, doc.content)
+		if err != nil {
+			return nil, err
+		}
+		if unified == "" {
+			continue
+		}
+
+		resourceDiff := ResourceDiff{File: fileName, Key: doc.key, Change: ResourceAdded, UnifiedDiff: unified}
+		if exists {
+			resourceDiff.Change = ResourceChanged
+			resourceDiff.Fields, err = diffFields(currentDoc.manifest, doc.manifest)
+			if err != nil {
+				return nil, fmt.Errorf("error comparing %v in %v:\n%w", doc.key, fileName, err)
+			}
+		}
+		diffs = append(diffs, resourceDiff)
+	}
+
+	for _, doc := range currentDocs {
+		if seen[doc.id] {
+			continue
+		}
+
+		unified, err := unifiedDiff(fileName, doc.key, doc.content, "")
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, ResourceDiff{File: fileName, Key: doc.key, Change: ResourceRemoved, UnifiedDiff: unified})
+	}
+
+	return diffs, nil
+}
+
+// diffFields returns the field level changes needed to turn the current resource into the rendered one.
+func diffFields(current map[string]any, rendered map[string]any) ([]FieldChange, error) {
+	changelog, err := diff.Diff(current, rendered, diff.SliceOrdering(true), diff.AllowTypeMismatch(true))
+	if err != nil {
+		return nil, err
+	}
+
+	var fields []FieldChange
+	for _, change := range changelog {
+		fields = append(fields, FieldChange{
+			Path: jsonPointer(change.Path),
+			Type: change.Type,
+			From: change.From,
+			To:   change.To,
+		})
+	}
+
+	// Map iteration order is random, sort to get a stable report
+	slices.SortStableFunc(fields, func(a, b FieldChange) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return fields, nil
+}
+
+// jsonPointer formats a path as a JSON pointer (RFC 6901).
+func jsonPointer(path []string) string {
+	var pointer strings.Builder
+	for _, segment := range path {
+		pointer.WriteString("/")
+		pointer.WriteString(strings.ReplaceAll(strings.ReplaceAll(segment, "~", "~0"), "/", "~1"))
+	}
+
+	return pointer.String()
+}
+
+// parseResourceDocuments splits manifests into YAML documents and identifies the resource in each of them.
+// Documents without content, e.g. only comments, are dropped.
+func parseResourceDocuments(manifests string) ([]resourceDocument, error) {
+	var result []resourceDocument
+	occurrences := make(map[string]int)
+
+	for _, doc := range splitYAMLDocuments(manifests) {
+		var manifest map[string]any
+		if err := yaml.Unmarshal(doc, &manifest); err != nil {
+			return nil, err
+		}
+		if manifest == nil {
+			continue
+		}
+
+		key := resourceKeyOf(manifest)
+
+		id := key.String()
+		occurrences[id]++
+		if occurrences[id] > 1 {
+			id = fmt.Sprintf("%v #%v", id, occurrences[id])
+		}
+
+		result = append(result, resourceDocument{key: key, id: id, content: strings.TrimRight(string(doc), "\n") + "\n", manifest: manifest})
+	}
+
+	return result, nil
+}
+
+// resourceKeyOf extracts the identifying fields of a Kubernetes resource.
+func resourceKeyOf(manifest map[string]any) ResourceKey {
+	var key ResourceKey
+
+	key.APIVersion, _ = manifest["apiVersion"].(string)
+	key.Kind, _ = manifest["kind"].(string)
+	if metadata, ok := manifest["metadata"].(map[string]any); ok {
+		key.Name, _ = metadata["name"].(string)
+		key.Namespace, _ = metadata["namespace"].(string)
+	}
+
+	return key
+}
+
+func unifiedDiff(fileName string, key ResourceKey, from string, to string) (string, error) {
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(from),
+		B:        difflib.SplitLines(to),
+		FromFile: fmt.Sprintf("a/%v (%v)", fileName, key),
+		ToFile:   fmt.Sprintf("b/%v (%v)", fileName, key),
+		Context:  3,
+	})
+}
@@ -0,0 +1,74 @@
+package domain
+
+import (
+	"testing"
+)
+
+const diffTestService = `# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+spec:
+  ports:
+    - port: 80
+`
+
+const diffTestDeployment = `# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+  namespace: web
+spec:
+  replicas: 2
+`
+
+func TestDiffManifestsIgnoresDocumentOrder(t *testing.T) {
+	current := "---\n" + diffTestService + "---\n" + diffTestDeployment
+	rendered := "---\n" + diffTestDeployment + "---\n" + diffTestService
+
+	diffs, err := DiffManifests("manifest.yaml", current, rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diffs) != 0 {
+		t.Errorf("expected no diffs, got %+v", diffs)
+	}
+}
+
+func TestDiffManifestsReportsChanges(t *testing.T) {
+	current := "---\n" + diffTestService + "---\n" + diffTestDeployment
+	rendered := "---\n" + diffTestDeployment[:len(diffTestDeployment)-2] + "3\n" + `---
+apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: config
+`
+
+	diffs, err := DiffManifests("manifest.yaml", current, rendered)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(diffs) != 3 {
+		t.Fatalf("expected 3 diffs, got %+v", diffs)
+	}
+
+	changed := diffs[0]
+	if changed.Change != ResourceChanged || changed.Key.Kind != "Deployment" || changed.Key.Namespace != "web" {
+		t.Errorf("expected changed Deployment web/app, got %v %v", changed.Change, changed.Key)
+	}
+	if len(changed.Fields) != 1 || changed.Fields[0].Path != "/spec/replicas" {
+		t.Errorf("expected a change of /spec/replicas, got %+v", changed.Fields)
+	}
+
+	if diffs[1].Change != ResourceAdded || diffs[1].Key.Kind != "ConfigMap" {
+		t.Errorf("expected added ConfigMap, got %v %v", diffs[1].Change, diffs[1].Key)
+	}
+
+	if diffs[2].Change != ResourceRemoved || diffs[2].Key.Kind != "Service" {
+		t.Errorf("expected removed Service, got %v %v", diffs[2].Change, diffs[2].Key)
+	}
+}
@@ -1,6 +1,7 @@
 package domain
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	stdpath "path"
@@ -9,6 +10,7 @@ import (
 	"github.com/goccy/go-yaml"
 	"github.com/stefan65535/helmer/internal/logger"
 	"github.com/stefan65535/helmer/internal/utils"
+	"helm.sh/helm/v4/pkg/chart/common/util"
 )
 
 type Document struct {
@@ -17,11 +19,13 @@ type Document struct {
 	Values       Values       `yaml:"values"`
 	Capabilities Capabilities `yaml:"capabilities,omitempty"`
 	Release      Release      `yaml:"release,omitempty"` // TODO remove?
+	Hooks        Hooks        `yaml:"hooks,omitempty"`
 	Target       *Target      `yaml:"target,omitempty"`
+	Policies     []*Policy    `yaml:"policies,omitempty"`
 
-	parent *Document
-	path   string // Path to the config file, used for detecting circular includes
-
+	parent      *Document
+	path        string       // Path to the config file, used for detecting circular includes
+	valueSource *valueSource // Where the global values of the config were defined
 }
 
 type Include struct {
@@ -40,19 +44,24 @@ func LoadDocument(parent *Document, path string, indent int) (*Document, error)
 	}
 
 	// Load
-	file, err := os.Open(path)
+	content, err := os.ReadFile(path)
 	if err != nil {
 		return nil, err
 	}
-	defer file.Close()
 
 	var doc Document
-	decoder := yaml.NewDecoder(file, yaml.DisallowUnknownField())
+	decoder := yaml.NewDecoder(bytes.NewReader(content), yaml.DisallowUnknownField())
 	if err := decoder.Decode(&doc); err != nil {
 		return nil, fmt.Errorf("error decoding %v:\n%w", path, err)
 	}
 	doc.parent = parent
 	doc.path = path
+	doc.trackValueSources(content)
+
+	// Resolve before merging, merging copies the top level of the values
+	if err := doc.Values.ResolveValueFileAndExternalRefs(stdpath.Dir(path)); err != nil {
+		return nil, err
+	}
 
 	GlobalValues = utils.MergeMaps(doc.Values, GlobalValues)
 
@@ -75,10 +84,6 @@ func (d *Document) ResolveDependencies(path string, indent int) error {
 		return err
 	}
 
-	if err := d.Values.ResolveValueFileAndExternalRefs(stdpath.Dir(path)); err != nil {
-		return err
-	}
-
 	return nil
 }
 
@@ -120,8 +125,9 @@ func (d *Document) loadCharts(path string, indent int) error {
 
 	logger.Verbose(indent, "Loading charts")
 	for _, chart := range d.Charts {
-		logger.Verbosef(indent+1, "Loading chart %v", chart.Path)
-		if err := chart.load(path); err != nil {
+		chart.config = d.path
+		logger.Verbosef(indent+1, "Loading chart %v", chart)
+		if err := chart.load(path, indent+2); err != nil {
 			return err
 		}
 
@@ -165,13 +171,87 @@ func (d *Document) ResolveChartValueRefs() error {
 	return nil
 }
 
+// trackValueSources records where the global and chart values of the document are defined, before directives are resolved.
+func (d *Document) trackValueSources(content []byte) {
+	depth := 0
+	for p := d.parent; p != nil; p = p.parent {
+		depth++
+	}
+
+	lines := yamlLines(content)
+	d.valueSource = newValueSource(sourceGlobal, d.path, depth, d.Values, lines, "/values")
+	for i, chart := range d.Charts {
+		chart.valueSource = newValueSource(sourceChart, d.path, depth, chart.Values, lines, fmt.Sprintf("/charts/%d/values", i))
+	}
+}
+
 func (d *Document) RenderTarget() error {
+	if err := d.setHelmerValues(); err != nil {
+		return err
+	}
+
+	logger.Verbosef(1, "Rendering target %v", d.Target.Path)
+	logger.Verbosef(2, "Global values: %+v", GlobalValues)
+
+	for _, chart := range d.CollectCharts() {
+		logger.Verbosef(2, "Rendering chart %v", chart)
+
+		rendered, err := chart.render()
+		if err != nil {
+			return err
+		}
+		d.Target.renderedReleases = append(d.Target.renderedReleases, rendered)
+	}
+
+	return nil
+}
+
+// ChartValues are the values a chart is rendered with.
+type ChartValues struct {
+	Chart     string         `json:"chart" yaml:"chart"`
+	TargetDir string         `json:"targetDir" yaml:"targetDir"`
+	Values    map[string]any `json:"values" yaml:"values"`
+}
+
+// ChartValues returns the values passed to Helm for each chart of the document with the given targetDir, or for all charts
+// if targetDir is empty. With withDefaults the values are merged with the chart defaults the way Helm does when rendering.
+func (d *Document) ChartValues(targetDir string, withDefaults bool) ([]ChartValues, error) {
+	if err := d.setHelmerValues(); err != nil {
+		return nil, err
+	}
+
+	var result []ChartValues
+	for _, chart := range d.CollectCharts() {
+		if targetDir != "" && chart.TargetDir != targetDir {
+			continue
+		}
+
+		values := GlobalValueOverrides.chartValues(chart)
+		if withDefaults {
+			coalesced, err := util.CoalesceValues(chart.resolved.charter, values)
+			if err != nil {
+				return nil, fmt.Errorf("chart %v: %w", chart, err)
+			}
+			values = Values(coalesced)
+		}
+
+		result = append(result, ChartValues{Chart: chart.String(), TargetDir: chart.TargetDir, Values: values})
+	}
+
+	if len(result) == 0 && targetDir != "" {
+		return nil, fmt.Errorf("no chart with targetDir %v", targetDir)
+	}
+
+	return result, nil
+}
+
+// setHelmerValues sets the Helmer values describing the target in the global values.
+func (d *Document) setHelmerValues() error {
 	docCharts := d.CollectCharts()
 
-	helmerValues := HelmerValues{
-		Target: HelmerTarget{
-			Path: d.Target.Path,
-		},
+	helmerValues := HelmerValues{}
+	if d.Target != nil {
+		helmerValues.Target.Path = d.Target.Path
 	}
 	for _, chart := range docCharts {
 		for _, sd := range helmerValues.Target.SubDirs {
@@ -195,28 +275,35 @@ func (d *Document) RenderTarget() error {
 	}
 	GlobalValues["Helmer"] = hv
 
-	logger.Verbosef(1, "Rendering target %v", d.Target.Path)
-	logger.Verbosef(2, "Global values: %+v", GlobalValues)
-
-	for _, chart := range docCharts {
-		logger.Verbosef(2, "Rendering chart %v", chart.Path)
+	return nil
+}
 
-		release, err := chart.render()
-		if err != nil {
+// WriteTarget writes the Document target to outputDir. If prune is set, files outside of the target directory are an error.
+func (d *Document) WriteTarget(outputDir string, prune bool) error {
+	if d.Target != nil {
+		if err := d.Target.write(outputDir, d.path, prune); err != nil {
 			return err
 		}
-		d.Target.renderedReleases = append(d.Target.renderedReleases, RenderedRelease{Release: release, TargetDir: chart.TargetDir})
 	}
 
 	return nil
 }
 
-func (d *Document) WriteTarget(outputDir string) error {
-	if d.Target != nil {
-		if err := d.Target.write(outputDir); err != nil {
-			return err
-		}
+// TrackTargetFiles records the files of the Document target, as returned by TargetFiles, as written without writing them.
+// StaleFiles then tells which files written in an earlier run are no longer rendered.
+func (d *Document) TrackTargetFiles(outputDir string, files []RenderedFile) error {
+	if d.Target == nil {
+		return nil
 	}
 
-	return nil
+	return d.Target.track(outputDir, d.path, files, false)
+}
+
+// TargetFiles returns the files the Document target would write to outputDir.
+func (d *Document) TargetFiles(outputDir string) ([]RenderedFile, error) {
+	if d.Target == nil {
+		return nil, nil
+	}
+
+	return d.Target.Files(outputDir)
 }
@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// loadTestConfig writes files, relative to a temporary directory that becomes the working directory, and loads the config
+// at path the way the commands do, with overrides as the values given on the command line.
+func loadTestConfig(t *testing.T, files map[string]string, path string, overrides ValueOverrides) *Document {
+	t.Helper()
+
+	dir := t.TempDir()
+	for name, content := range files {
+		filePath := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Chdir(dir)
+
+	InitGlobalValues()
+	GlobalCapabilities = Capabilities{}
+	GlobalRelease = Release{Name: "release-name", Namespace: "release-namespace"}
+	GlobalHooks = Hooks{}
+	GlobalValueOverrides = overrides
+	t.Cleanup(func() {
+		InitGlobalValues()
+		GlobalValueOverrides = ValueOverrides{}
+	})
+
+	doc, err := LoadDocument(nil, path, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	MergeValueOverrides()
+	if err := GlobalValues.ResolveValueRefs(); err != nil {
+		t.Fatal(err)
+	}
+	if err := doc.ResolveChartValueRefs(); err != nil {
+		t.Fatal(err)
+	}
+
+	return doc
+}
+
+func TestDocumentChartValues(t *testing.T) {
+	files := map[string]string{
+		"values.yaml":            "replicas: 1\nimage:\n  repository: nginx\n  tag: latest\n",
+		"templates/service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: app\n",
+	}
+	web := &Chart{TargetDir: "web", Values: Values{"image": map[string]any{"tag": "v2"}}}
+	localChart(t, web, files)
+	api := &Chart{TargetDir: "api"}
+	localChart(t, api, files)
+
+	InitGlobalValues()
+	GlobalValues["team"] = "shop"
+	t.Cleanup(InitGlobalValues)
+
+	doc := Document{Target: &Target{Path: "prod"}, Charts: []*Chart{web, api}}
+
+	all, err := doc.ChartValues("", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var targetDirs []string
+	for _, chartValues := range all {
+		targetDirs = append(targetDirs, chartValues.TargetDir)
+	}
+	if !reflect.DeepEqual(targetDirs, []string{"web", "api"}) {
+		t.Errorf("expected values of web and api, got %v", targetDirs)
+	}
+
+	// Without defaults only the values Helmer passes to Helm are returned
+	values, err := doc.ChartValues("web", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 || values[0].TargetDir != "web" {
+		t.Fatalf("expected values of web, got %+v", values)
+	}
+	if values[0].Values["team"] != "shop" || !reflect.DeepEqual(values[0].Values["image"], map[string]any{"tag": "v2"}) {
+		t.Errorf("expected global and chart values, got %v", values[0].Values)
+	}
+	if _, ok := values[0].Values["replicas"]; ok {
+		t.Errorf("expected no chart defaults, got %v", values[0].Values)
+	}
+
+	// With defaults the values are coalesced with the chart defaults, the values of the config take precedence
+	values, err = doc.ChartValues("web", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(values) != 1 {
+		t.Fatalf("expected values of web, got %+v", values)
+	}
+	if _, ok := values[0].Values["replicas"]; !ok || values[0].Values["team"] != "shop" {
+		t.Errorf("expected global values and chart defaults, got %v", values[0].Values)
+	}
+	if expected := map[string]any{"repository": "nginx", "tag": "v2"}; !reflect.DeepEqual(values[0].Values["image"], expected) {
+		t.Errorf("expected image %v, got %v", expected, values[0].Values["image"])
+	}
+
+	if _, err := doc.ChartValues("db", false); err == nil || err.Error() != "no chart with targetDir db" {
+		t.Errorf("expected error for unknown targetDir, got %v", err)
+	}
+}
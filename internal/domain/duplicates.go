@@ -0,0 +1,118 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Duplicate policies
+const (
+	DuplicatesFail = "fail" // Rendering fails if a resource is rendered more than once in a target. This is the default.
+	DuplicatesWarn = "warn" // Resources rendered more than once are reported only.
+)
+
+// DuplicateResource is a resource rendered more than once in a target, e.g. by two charts.
+type DuplicateResource struct {
+	Resource ResourceKey
+	Copies   []ResourceCopy
+}
+
+// ResourceCopy tells which chart rendered a copy of a duplicate resource.
+type ResourceCopy struct {
+	Chart     string
+	TargetDir string
+	Config    string // Config file the chart is declared in
+}
+
+func (d DuplicateResource) String() string {
+	var copies []string
+	for _, c := range d.Copies {
+		copies = append(copies, fmt.Sprintf("chart %v (targetDir %v) in %v", c.Chart, c.TargetDir, c.Config))
+	}
+
+	return fmt.Sprintf("%v is rendered %v times, by %v", d.Resource, len(d.Copies), strings.Join(copies, ", "))
+}
+
+func (t *Target) duplicatesPolicy() (string, error) {
+	switch t.Duplicates {
+	case "":
+		return DuplicatesFail, nil
+	case DuplicatesFail, DuplicatesWarn:
+		return t.Duplicates, nil
+	default:
+		return "", fmt.Errorf("unknown target duplicates policy %q, must be one of %v or %v", t.Duplicates, DuplicatesFail, DuplicatesWarn)
+	}
+}
+
+// CheckDuplicates finds resources rendered more than once in the target of the document. Resources are the same if they have
+// the same API group, kind, namespace and name, whatever the version. With the fail policy an error listing all duplicates is
+// returned, with the warn policy the duplicates are returned. RenderTarget must be called first.
+func (d *Document) CheckDuplicates() ([]DuplicateResource, error) {
+	if d.Target == nil {
+		return nil, nil
+	}
+
+	policy, err := d.Target.duplicatesPolicy()
+	if err != nil {
+		return nil, err
+	}
+
+	duplicates, err := d.Target.findDuplicates()
+	if err != nil {
+		return nil, err
+	}
+
+	if policy == DuplicatesFail && len(duplicates) > 0 {
+		var messages []string
+		for _, duplicate := range duplicates {
+			messages = append(messages, duplicate.String())
+		}
+
+		return nil, fmt.Errorf("resources rendered more than once in target %v:\n  %v", d.Target.Path, strings.Join(messages, "\n  "))
+	}
+
+	return duplicates, nil
+}
+
+// findDuplicates indexes the resources of all rendered releases and returns those rendered more than once, in render order.
+func (t *Target) findDuplicates() ([]DuplicateResource, error) {
+	type objectKey struct {
+		group, kind, namespace, name string
+	}
+
+	var order []objectKey
+	index := make(map[objectKey]*DuplicateResource)
+
+	for _, release := range t.renderedReleases {
+		resourceCopy := ResourceCopy{TargetDir: release.TargetDir}
+		if release.chart != nil {
+			resourceCopy.Chart = release.chart.String()
+			resourceCopy.Config = release.chart.config
+		}
+
+		for _, manifest := range []string{release.CRDsManifest, release.Release.Manifest, release.HooksManifest} {
+			docs, err := parseResourceDocuments(manifest)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing manifests of %v: %w", release.TargetDir, err)
+			}
+
+			for _, doc := range docs {
+				key := objectKey{apiGroup(doc.key.APIVersion), doc.key.Kind, doc.key.Namespace, doc.key.Name}
+				if _, ok := index[key]; !ok {
+					index[key] = &DuplicateResource{Resource: doc.key}
+					order = append(order, key)
+				}
+				index[key].Copies = append(index[key].Copies, resourceCopy)
+			}
+		}
+	}
+
+	var duplicates []DuplicateResource
+	for _, key := range order {
+		if len(index[key].Copies) > 1 {
+			duplicates = append(duplicates, *index[key])
+		}
+	}
+
+	return duplicates, nil
+}
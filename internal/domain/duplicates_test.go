@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckDuplicates(t *testing.T) {
+	serviceAccount := "---\napiVersion: v1\nkind: ServiceAccount\nmetadata:\n  name: foo\n  namespace: default\n"
+	deployment := "---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: foo\n"
+	oldDeployment := "---\napiVersion: apps/v1beta1\nkind: Deployment\nmetadata:\n  name: foo\n"
+
+	doc := Document{Target: &Target{Path: "prod"}}
+	doc.Target.renderedReleases = []RenderedRelease{
+		renderedRelease("a", serviceAccount+deployment),
+		renderedRelease("b", serviceAccount+oldDeployment),
+	}
+
+	if _, err := doc.CheckDuplicates(); err == nil || !strings.Contains(err.Error(), "v1 ServiceAccount default/foo is rendered 2 times") {
+		t.Errorf("expected duplicate ServiceAccount error, got %v", err)
+	}
+
+	doc.Target.Duplicates = DuplicatesWarn
+	duplicates, err := doc.CheckDuplicates()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(duplicates) != 2 || duplicates[1].Resource.Kind != "Deployment" || duplicates[1].Copies[1].TargetDir != "b" {
+		t.Errorf("expected duplicate ServiceAccount and Deployment, got %v", duplicates)
+	}
+}
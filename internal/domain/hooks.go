@@ -0,0 +1,155 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/stefan65535/helmer/internal/logger"
+	releasev1 "helm.sh/helm/v4/pkg/release/v1"
+)
+
+// Hook policies
+const (
+	HooksExclude      = "exclude"      // Hooks are dropped. This is the default.
+	HooksInclude      = "include"      // Hooks are written along with the other manifests of the chart.
+	HooksSeparateFile = "separateFile" // Hooks are written to hooks.yaml next to the manifests of the chart.
+)
+
+// Hooks controls what happens to the Helm hook resources of a chart.
+type Hooks struct {
+	Policy string `yaml:"policy,omitempty"`
+	ArgoCD *bool  `yaml:"argoCD,omitempty"` // Translate Helm hook annotations into ArgoCD hook annotations
+}
+
+var GlobalHooks Hooks
+
+// ArgoCD annotations
+const (
+	argoCDHookAnnotation         = "argocd.argoproj.io/hook"
+	argoCDSyncWaveAnnotation     = "argocd.argoproj.io/sync-wave"
+	argoCDDeletePolicyAnnotation = "argocd.argoproj.io/hook-delete-policy"
+)
+
+var argoCDHookEvents = map[releasev1.HookEvent]string{
+	releasev1.HookPreInstall:  "PreSync",
+	releasev1.HookPreUpgrade:  "PreSync",
+	releasev1.HookPostInstall: "PostSync",
+	releasev1.HookPostUpgrade: "PostSync",
+	releasev1.HookPreDelete:   "PreDelete",
+	releasev1.HookPostDelete:  "PostDelete",
+}
+
+var argoCDDeletePolicies = map[releasev1.HookDeletePolicy]string{
+	releasev1.HookSucceeded:          "HookSucceeded",
+	releasev1.HookFailed:             "HookFailed",
+	releasev1.HookBeforeHookCreation: "BeforeHookCreation",
+}
+
+// override returns h with the fields set in o replaced.
+func (h Hooks) override(o Hooks) Hooks {
+	if o.Policy != "" {
+		h.Policy = o.Policy
+	}
+	if o.ArgoCD != nil {
+		h.ArgoCD = o.ArgoCD
+	}
+
+	return h
+}
+
+func (h Hooks) policy() (string, error) {
+	switch h.Policy {
+	case "":
+		return HooksExclude, nil
+	case HooksExclude, HooksInclude, HooksSeparateFile:
+		return h.Policy, nil
+	default:
+		return "", fmt.Errorf("unknown hooks policy %q, must be one of %v, %v or %v", h.Policy, HooksInclude, HooksExclude, HooksSeparateFile)
+	}
+}
+
+// renderHooks renders the hooks of a release as a multi document manifest, the same way helm template does.
+// If translating to ArgoCD, hooks only fired on events ArgoCD has no counterpart for, like tests and rollbacks, are dropped.
+func renderHooks(hooks []*releasev1.Hook, settings Hooks) (string, error) {
+	var result strings.Builder
+
+	for _, hook := range hooks {
+		manifest := hook.Manifest
+
+		if settings.ArgoCD != nil && *settings.ArgoCD {
+			var err error
+			manifest, err = argoCDHook(hook)
+			if err != nil {
+				return "", err
+			}
+			if manifest == "" {
+				logger.Verbosef(3, "Dropping hook %v %v, ArgoCD has no hook for events %v", hook.Kind, hook.Name, hook.Events)
+				continue
+			}
+		}
+
+		fmt.Fprintf(&result, "---\n# Source: %v\n%v\n", hook.Path, strings.TrimRight(manifest, "\n"))
+	}
+
+	return result.String(), nil
+}
+
+// argoCDHook returns the manifest of a hook with the Helm hook annotations replaced by ArgoCD hook and sync wave annotations.
+// An empty manifest is returned if none of the hook events have an ArgoCD counterpart.
+func argoCDHook(hook *releasev1.Hook) (string, error) {
+	var argoHooks []string
+	for _, event := range hook.Events {
+		if argoHook, ok := argoCDHookEvents[event]; ok && !slices.Contains(argoHooks, argoHook) {
+			argoHooks = append(argoHooks, argoHook)
+		}
+	}
+	if len(argoHooks) == 0 {
+		return "", nil
+	}
+
+	var manifest map[string]any
+	if err := yaml.Unmarshal([]byte(hook.Manifest), &manifest); err != nil {
+		return "", fmt.Errorf("error parsing hook %v:\n%w", hook.Path, err)
+	}
+
+	metadata, ok := manifest["metadata"].(map[string]any)
+	if !ok {
+		metadata = make(map[string]any)
+		manifest["metadata"] = metadata
+	}
+	annotations, ok := metadata["annotations"].(map[string]any)
+	if !ok {
+		annotations = make(map[string]any)
+		metadata["annotations"] = annotations
+	}
+
+	delete(annotations, releasev1.HookAnnotation)
+	delete(annotations, releasev1.HookWeightAnnotation)
+	delete(annotations, releasev1.HookDeleteAnnotation)
+	delete(annotations, releasev1.HookOutputLogAnnotation)
+
+	annotations[argoCDHookAnnotation] = strings.Join(argoHooks, ",")
+	if hook.Weight != 0 {
+		annotations[argoCDSyncWaveAnnotation] = strconv.Itoa(hook.Weight)
+	}
+
+	var deletePolicies []string
+	for _, policy := range hook.DeletePolicies {
+		if argoPolicy, ok := argoCDDeletePolicies[policy]; ok {
+			deletePolicies = append(deletePolicies, argoPolicy)
+		}
+	}
+	if len(deletePolicies) > 0 {
+		annotations[argoCDDeletePolicyAnnotation] = strings.Join(deletePolicies, ",")
+	}
+
+	out, err := yaml.Marshal(manifest)
+	if err != nil {
+		return "", fmt.Errorf("error marshaling hook %v: %w", hook.Path, err)
+	}
+
+	return string(out), nil
+}
@@ -0,0 +1,249 @@
+package domain
+
+import (
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	releasev1 "helm.sh/helm/v4/pkg/release/v1"
+)
+
+// localChart writes a chart named app with the given files, relative to the chart directory, to a temporary directory
+// and loads it as the chart of c.
+func localChart(t *testing.T, c *Chart, files map[string]string) {
+	t.Helper()
+
+	dir := t.TempDir()
+	files = maps.Clone(files)
+	files["Chart.yaml"] = "apiVersion: v2\nname: app\nversion: 1.0.0\n"
+	for name, content := range files {
+		path := filepath.Join(dir, "app", filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c.Path = "app"
+	if err := c.load(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestArgoCDHook(t *testing.T) {
+	manifest := `apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-install
+    helm.sh/hook-weight: "-5"
+    helm.sh/hook-delete-policy: hook-succeeded
+    example.com/owner: team-a
+`
+	for _, test := range []struct {
+		name     string
+		hook     releasev1.Hook
+		expected map[string]any // Annotations of the translated hook, nil if the hook is dropped
+	}{
+		{
+			name: "pre install and upgrade",
+			hook: releasev1.Hook{Events: []releasev1.HookEvent{releasev1.HookPreInstall, releasev1.HookPreUpgrade}},
+			expected: map[string]any{
+				"argocd.argoproj.io/hook": "PreSync",
+				"example.com/owner":       "team-a",
+			},
+		},
+		{
+			name: "post install with weight and delete policies",
+			hook: releasev1.Hook{
+				Events:         []releasev1.HookEvent{releasev1.HookPostInstall},
+				Weight:         -5,
+				DeletePolicies: []releasev1.HookDeletePolicy{releasev1.HookSucceeded, releasev1.HookBeforeHookCreation},
+			},
+			expected: map[string]any{
+				"argocd.argoproj.io/hook":               "PostSync",
+				"argocd.argoproj.io/sync-wave":          "-5",
+				"argocd.argoproj.io/hook-delete-policy": "HookSucceeded,BeforeHookCreation",
+				"example.com/owner":                     "team-a",
+			},
+		},
+		{
+			name: "delete events",
+			hook: releasev1.Hook{
+				Events:         []releasev1.HookEvent{releasev1.HookPreDelete, releasev1.HookPostDelete},
+				DeletePolicies: []releasev1.HookDeletePolicy{releasev1.HookFailed},
+			},
+			expected: map[string]any{
+				"argocd.argoproj.io/hook":               "PreDelete,PostDelete",
+				"argocd.argoproj.io/hook-delete-policy": "HookFailed",
+				"example.com/owner":                     "team-a",
+			},
+		},
+		{
+			name: "events without counterpart are ignored",
+			hook: releasev1.Hook{Events: []releasev1.HookEvent{releasev1.HookPreRollback, releasev1.HookPostUpgrade}, Weight: 3},
+			expected: map[string]any{
+				"argocd.argoproj.io/hook":      "PostSync",
+				"argocd.argoproj.io/sync-wave": "3",
+				"example.com/owner":            "team-a",
+			},
+		},
+		{
+			name: "test hook",
+			hook: releasev1.Hook{Events: []releasev1.HookEvent{releasev1.HookTest}},
+		},
+		{
+			name: "rollback hook",
+			hook: releasev1.Hook{Events: []releasev1.HookEvent{releasev1.HookPreRollback, releasev1.HookPostRollback}},
+		},
+	} {
+		test.hook.Path = "app/templates/job.yaml"
+		test.hook.Manifest = manifest
+
+		translated, err := argoCDHook(&test.hook)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+
+		if test.expected == nil {
+			if translated != "" {
+				t.Errorf("%v: expected hook to be dropped, got\n%v", test.name, translated)
+			}
+			continue
+		}
+
+		var document struct {
+			Metadata struct {
+				Name        string         `yaml:"name"`
+				Annotations map[string]any `yaml:"annotations"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(translated), &document); err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if document.Metadata.Name != "migrate" {
+			t.Errorf("%v: expected name migrate, got %v", test.name, document.Metadata.Name)
+		}
+		if !reflect.DeepEqual(document.Metadata.Annotations, test.expected) {
+			t.Errorf("%v: expected annotations %v, got %v", test.name, test.expected, document.Metadata.Annotations)
+		}
+	}
+}
+
+func TestRenderHooks(t *testing.T) {
+	hooks := []*releasev1.Hook{
+		{
+			Path:     "app/templates/job.yaml",
+			Manifest: "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n  annotations:\n    helm.sh/hook: pre-upgrade\n",
+			Events:   []releasev1.HookEvent{releasev1.HookPreUpgrade},
+		},
+		{
+			Path:     "app/templates/tests/connection.yaml",
+			Manifest: "apiVersion: v1\nkind: Pod\nmetadata:\n  name: test-connection\n  annotations:\n    helm.sh/hook: test\n",
+			Events:   []releasev1.HookEvent{releasev1.HookTest},
+		},
+	}
+
+	argoCD := true
+	for _, test := range []struct {
+		name     string
+		settings Hooks
+		expected string
+	}{
+		{
+			name:     "helm",
+			settings: Hooks{},
+			expected: `---
+# Source: app/templates/job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  name: migrate
+  annotations:
+    helm.sh/hook: pre-upgrade
+---
+# Source: app/templates/tests/connection.yaml
+apiVersion: v1
+kind: Pod
+metadata:
+  name: test-connection
+  annotations:
+    helm.sh/hook: test
+`,
+		},
+		{
+			name:     "argoCD drops test hooks",
+			settings: Hooks{ArgoCD: &argoCD},
+			expected: `---
+# Source: app/templates/job.yaml
+apiVersion: batch/v1
+kind: Job
+metadata:
+  annotations:
+    argocd.argoproj.io/hook: PreSync
+  name: migrate
+`,
+		},
+	} {
+		manifest, err := renderHooks(hooks, test.settings)
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if manifest != test.expected {
+			t.Errorf("%v: expected\n%v\ngot\n%v", test.name, test.expected, manifest)
+		}
+	}
+}
+
+func TestChartRenderHooksPolicy(t *testing.T) {
+	files := map[string]string{
+		"templates/service.yaml": "apiVersion: v1\nkind: Service\nmetadata:\n  name: app\n",
+		"templates/job.yaml":     "apiVersion: batch/v1\nkind: Job\nmetadata:\n  name: migrate\n  annotations:\n    helm.sh/hook: post-install\n",
+	}
+
+	for _, test := range []struct {
+		policy      string
+		inManifest  bool // The hook is part of the manifest of the chart
+		inHooksFile bool // The hook is written to hooks.yaml
+	}{
+		{"", false, false},
+		{HooksExclude, false, false},
+		{HooksInclude, true, false},
+		{HooksSeparateFile, false, true},
+	} {
+		c := Chart{Release: Release{Name: "app"}, Hooks: Hooks{Policy: test.policy}}
+		localChart(t, &c, files)
+
+		rendered, err := c.render()
+		if err != nil {
+			t.Errorf("policy %q: %v", test.policy, err)
+			continue
+		}
+
+		if !strings.Contains(rendered.Release.Manifest, "name: app") {
+			t.Errorf("policy %q: expected the service in the manifest, got\n%v", test.policy, rendered.Release.Manifest)
+		}
+		if strings.Contains(rendered.Release.Manifest, "name: migrate") != test.inManifest {
+			t.Errorf("policy %q: expected hook in manifest %v, got\n%v", test.policy, test.inManifest, rendered.Release.Manifest)
+		}
+		if strings.Contains(rendered.HooksManifest, "name: migrate") != test.inHooksFile {
+			t.Errorf("policy %q: expected hook in hooks file %v, got\n%v", test.policy, test.inHooksFile, rendered.HooksManifest)
+		}
+	}
+
+	c := Chart{Release: Release{Name: "app"}, Hooks: Hooks{Policy: "keep"}}
+	localChart(t, &c, files)
+	if _, err := c.render(); err == nil {
+		t.Error("expected error for unknown hooks policy")
+	}
+}
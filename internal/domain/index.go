@@ -0,0 +1,278 @@
+package domain
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"maps"
+	"os"
+	stdpath "path"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/stefan65535/helmer/internal/logger"
+)
+
+// IndexFile is the name of the file in the root of each target directory listing the files Helmer wrote there.
+// It tells which files Helmer owns, so stale files can be pruned without touching files written by someone else.
+const IndexFile = ".helmer-files"
+
+const indexHeader = "# Files written by Helmer, by config. Files listed here are deleted by helmer template --prune when the config\n" +
+	"# no longer renders them.\n"
+
+// targetFiles holds the configs and files written to a target directory by this process.
+type targetFiles struct {
+	dir     string            // The directory as first given
+	configs map[string]bool   // Configs written to the directory
+	files   map[string]string // Config each file was written by. Paths are slash separated and relative to the directory.
+}
+
+// writtenFiles holds the files written by this process, keyed by absolute target directory.
+var writtenFiles = make(map[string]*targetFiles)
+
+// configKey returns how a config file is identified in the index, its slash separated path as given on the command line.
+func configKey(config string) string {
+	return filepath.ToSlash(filepath.Clean(config))
+}
+
+// trackTarget records that a config is written to a target directory, even if no files end up in it.
+func trackTarget(targetDir string, config string) error {
+	absTargetDir, err := filepath.Abs(targetDir)
+	if err != nil {
+		return err
+	}
+
+	if writtenFiles[absTargetDir] == nil {
+		writtenFiles[absTargetDir] = &targetFiles{dir: targetDir, configs: make(map[string]bool), files: make(map[string]string)}
+	}
+	writtenFiles[absTargetDir].configs[configKey(config)] = true
+
+	return nil
+}
+
+// unindexedFiles holds the files written by this process outside of their target directory, see UnindexedFiles.
+var unindexedFiles []string
+
+// trackWrittenFile records that a config writes a file to a target directory. Files outside of the target directory,
+// e.g. because crdsDir is ../crds, can't be owned by the index. They are left out of it, or rejected if pruning, as the
+// index of the target directory can't tell if they are stale.
+func trackWrittenFile(targetDir string, config string, fileName string, prune bool) error {
+	if err := trackTarget(targetDir, config); err != nil {
+		return err
+	}
+
+	absTargetDir, err := filepath.Abs(targetDir)
+	if err != nil {
+		return err
+	}
+	absFileName, err := filepath.Abs(fileName)
+	if err != nil {
+		return err
+	}
+
+	relFileName, err := filepath.Rel(absTargetDir, absFileName)
+	if err != nil {
+		return err
+	}
+	if !filepath.IsLocal(relFileName) {
+		if prune {
+			return fmt.Errorf("%v is outside of the target directory %v and can't be pruned, targetDir and crdsDir of charts must be within the target when pruning", fileName, targetDir)
+		}
+		if !slices.Contains(unindexedFiles, fileName) {
+			unindexedFiles = append(unindexedFiles, fileName)
+		}
+		return nil
+	}
+	writtenFiles[absTargetDir].files[filepath.ToSlash(relFileName)] = configKey(config)
+
+	return nil
+}
+
+// UnindexedFiles returns the files written outside of their target directory, which are not listed in any index and so
+// are never pruned.
+func UnindexedFiles() []string {
+	return unindexedFiles
+}
+
+// WriteTargetIndexes writes the index file of every target directory written by this process.
+// Files listed in the previous index stay listed, unless written by another config this time, so files of configs not
+// written in this run, e.g. because they weren't given on the command line or violate a deny policy, stay owned.
+// If prune is set, files listed for a config written in this run that it didn't write this time are deleted first,
+// along with directories left empty. Returns the deleted files.
+func WriteTargetIndexes(prune bool) ([]string, error) {
+	var pruned []string
+	for _, targetDir := range slices.Sorted(maps.Keys(writtenFiles)) {
+		written := writtenFiles[targetDir]
+		indexPath := filepath.Join(targetDir, IndexFile)
+
+		index, err := previousIndex(targetDir, written)
+		if err != nil {
+			return pruned, err
+		}
+
+		if prune {
+			for _, file := range staleFiles(index, written) {
+				path := filepath.Join(targetDir, filepath.FromSlash(file))
+				logger.Verbosef(1, "Pruning %v", path)
+				if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					return pruned, err
+				}
+				pruned = append(pruned, path)
+
+				removeEmptyDirs(filepath.Dir(path), targetDir)
+			}
+
+			for config := range written.configs {
+				delete(index, config)
+			}
+		}
+
+		for file, config := range written.files {
+			if index[config] == nil {
+				index[config] = make(map[string]bool)
+			}
+			index[config][file] = true
+		}
+
+		// A target directory nothing was ever written to, e.g. because all files are outside of it, gets no index
+		if !slices.ContainsFunc(slices.Collect(maps.Values(index)), func(files map[string]bool) bool { return len(files) > 0 }) {
+			if _, err := os.Stat(indexPath); errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+		}
+
+		if err := os.WriteFile(indexPath, []byte(formatIndex(index)), 0644); err != nil {
+			return pruned, err
+		}
+	}
+
+	return pruned, nil
+}
+
+// previousIndex returns the files listed in the index of a target directory, by config, leaving out the files written in
+// this run.
+func previousIndex(targetDir string, written *targetFiles) (map[string]map[string]bool, error) {
+	index, err := readIndex(filepath.Join(targetDir, IndexFile))
+	if err != nil {
+		return nil, err
+	}
+
+	for file := range written.files {
+		for _, files := range index {
+			delete(files, file)
+		}
+	}
+
+	return index, nil
+}
+
+// staleFiles returns the files listed in an index, for a config written in this run, that weren't written this time.
+// The index must not list files written in this run, see previousIndex. Returns sorted slash separated paths relative to the target directory.
+func staleFiles(index map[string]map[string]bool, written *targetFiles) []string {
+	var stale []string
+	for config, files := range index {
+		if !written.configs[config] {
+			continue
+		}
+		stale = append(stale, slices.Collect(maps.Keys(files))...)
+	}
+	slices.Sort(stale)
+
+	return stale
+}
+
+// StaleFiles returns the files written to the target directories in an earlier run that the configs written in this run no
+// longer render, the files WriteTargetIndexes deletes when pruning. Paths are within the target directories as given.
+func StaleFiles() ([]string, error) {
+	var stale []string
+	for _, targetDir := range slices.Sorted(maps.Keys(writtenFiles)) {
+		written := writtenFiles[targetDir]
+
+		index, err := previousIndex(targetDir, written)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range staleFiles(index, written) {
+			stale = append(stale, stdpath.Join(written.dir, file))
+		}
+	}
+
+	return stale, nil
+}
+
+// readIndex returns the files listed in an index file, by config. A missing index lists no files.
+// Files listed before the first config section are listed for the empty config, which is never written.
+func readIndex(indexPath string) (map[string]map[string]bool, error) {
+	index := make(map[string]map[string]bool)
+
+	file, err := os.Open(indexPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	config := ""
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			config = line[1 : len(line)-1]
+			continue
+		}
+
+		// Never follow an index outside of its target directory
+		if !filepath.IsLocal(filepath.FromSlash(line)) {
+			return nil, fmt.Errorf("error reading %v: %q is not a path within the target directory", indexPath, line)
+		}
+
+		if index[config] == nil {
+			index[config] = make(map[string]bool)
+		}
+		index[config][line] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading %v: %w", indexPath, err)
+	}
+
+	return index, nil
+}
+
+// formatIndex formats the files of an index by config, both sorted, with a section per config.
+func formatIndex(index map[string]map[string]bool) string {
+	var result strings.Builder
+	result.WriteString(indexHeader)
+
+	for _, config := range slices.Sorted(maps.Keys(index)) {
+		if len(index[config]) == 0 {
+			continue
+		}
+		if config != "" {
+			result.WriteString("[" + config + "]\n")
+		}
+		for _, file := range slices.Sorted(maps.Keys(index[config])) {
+			result.WriteString(file + "\n")
+		}
+	}
+
+	return result.String()
+}
+
+// removeEmptyDirs removes dir and its parents up to, but not including, stopDir as long as they are empty.
+func removeEmptyDirs(dir string, stopDir string) {
+	for dir != stopDir && strings.HasPrefix(dir, stopDir+string(filepath.Separator)) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
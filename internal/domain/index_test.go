@@ -0,0 +1,132 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteTargetIndexesPrune(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string) {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("---\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(dir, filepath.FromSlash(name)))
+		return err == nil
+	}
+	// render simulates a run writing files, given as config:file, to the target directory
+	render := func(configs []string, files ...string) {
+		writtenFiles = make(map[string]*targetFiles)
+		t.Cleanup(func() { writtenFiles = make(map[string]*targetFiles) })
+
+		for _, config := range configs {
+			if err := trackTarget(dir, config); err != nil {
+				t.Fatal(err)
+			}
+		}
+		for _, file := range files {
+			config, name, _ := strings.Cut(file, ":")
+			write(name)
+			if err := trackWrittenFile(dir, config, filepath.Join(dir, name), true); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	render([]string{"prod.yaml"}, "prod.yaml:app/manifest.yaml", "prod.yaml:old/manifest.yaml")
+	if _, err := WriteTargetIndexes(true); err != nil {
+		t.Fatal(err)
+	}
+
+	write("old/README.md")
+	write("gone/manifest.yaml")
+
+	render([]string{"prod.yaml"}, "prod.yaml:app/manifest.yaml")
+	stale, err := StaleFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stale) != 1 || stale[0] != filepath.ToSlash(filepath.Join(dir, "old", "manifest.yaml")) {
+		t.Errorf("expected old/manifest.yaml to be stale, got %v", stale)
+	}
+	if _, err := WriteTargetIndexes(true); err != nil {
+		t.Fatal(err)
+	}
+
+	if exists("old/manifest.yaml") {
+		t.Error("expected stale file old/manifest.yaml to be pruned")
+	}
+	if !exists("old/README.md") || !exists("gone/manifest.yaml") {
+		t.Error("expected files not written by Helmer to be kept")
+	}
+	if !exists("app/manifest.yaml") {
+		t.Error("expected rendered file app/manifest.yaml to be kept")
+	}
+
+	render([]string{"prod.yaml"})
+	if _, err := WriteTargetIndexes(true); err != nil {
+		t.Fatal(err)
+	}
+	if exists("app/manifest.yaml") || exists("app") {
+		t.Error("expected app/manifest.yaml and its directory to be pruned when no longer rendered")
+	}
+}
+
+func TestWriteTargetIndexesPruneOtherConfigs(t *testing.T) {
+	dir := t.TempDir()
+	render := func(files map[string]string) {
+		writtenFiles = make(map[string]*targetFiles)
+		t.Cleanup(func() { writtenFiles = make(map[string]*targetFiles) })
+
+		for name, config := range files {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, []byte("---\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := trackWrittenFile(dir, config, path, true); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	render(map[string]string{"app/manifest.yaml": "configs/app.yaml", "db/manifest.yaml": "configs/db.yaml"})
+	if _, err := WriteTargetIndexes(true); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only app is written, e.g. because db wasn't given on the command line or violates a deny policy. The files of db
+	// stay listed and are not pruned
+	render(map[string]string{"app/manifest.yaml": "configs/app.yaml"})
+	pruned, err := WriteTargetIndexes(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pruned) > 0 {
+		t.Errorf("expected nothing to be pruned, got %v", pruned)
+	}
+
+	index, err := os.ReadFile(filepath.Join(dir, IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := indexHeader + "[configs/app.yaml]\napp/manifest.yaml\n[configs/db.yaml]\ndb/manifest.yaml\n"
+	if string(index) != expected {
+		t.Errorf("expected index\n%v\ngot\n%v", expected, string(index))
+	}
+
+	// Files outside of the target directory can't be owned, they are rejected when pruning
+	if err := trackWrittenFile(dir, "configs/app.yaml", filepath.Join(dir, "..", "crds", "manifest.yaml"), true); err == nil {
+		t.Error("expected a file outside of the target directory to be rejected")
+	}
+}
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+)
+
+// DefaultLockfile is the name of the lockfile used if none is given.
+const DefaultLockfile = "helmer.lock"
+
+// Lockfile pins every chart reference to the exact version and content digest it resolved to.
+type Lockfile struct {
+	Charts []*LockedChart `yaml:"charts"`
+
+	path   string
+	pinned map[string]bool // Charts pinned by Update in this run
+}
+
+type LockedChart struct {
+	Chart   string `yaml:"chart"`   // Chart reference. Local charts are given relative to the lockfile.
+	Version string `yaml:"version"` // Resolved chart version
+	Digest  string `yaml:"digest"`  // Content digest of the chart
+}
+
+// NewLockfile returns an empty lockfile to be written to path.
+func NewLockfile(path string) *Lockfile {
+	return &Lockfile{path: path}
+}
+
+// LoadLockfile reads a lockfile from path.
+func LoadLockfile(path string) (*Lockfile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	lock := Lockfile{path: path}
+	decoder := yaml.NewDecoder(file, yaml.DisallowUnknownField())
+	if err := decoder.Decode(&lock); err != nil {
+		return nil, fmt.Errorf("error decoding lockfile %v:\n%w", path, err)
+	}
+
+	return &lock, nil
+}
+
+// Verify checks that every chart resolved to the version and digest pinned in the lockfile.
+// All mismatching charts are reported in the returned error.
+func (l *Lockfile) Verify(charts []*Chart) error {
+	var errs []error
+
+	for _, chart := range charts {
+		actual := l.lockedChart(chart)
+
+		locked := l.find(actual.Chart)
+		if locked == nil {
+			errs = append(errs, fmt.Errorf("chart %v is not in lockfile %v", actual.Chart, l.path))
+			continue
+		}
+
+		if locked.Version != actual.Version || locked.Digest != actual.Digest {
+			errs = append(errs, fmt.Errorf("chart %v resolved to version %v digest %v, but lockfile %v has version %v digest %v",
+				actual.Chart, actual.Version, actual.Digest, l.path, locked.Version, locked.Digest))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Update pins the charts to what they resolved to, adding charts that are not yet in the lockfile. Charts not pinned by
+// Update in this run are dropped by Write, so the lockfile is rebuilt from the charts resolved in the run.
+func (l *Lockfile) Update(charts []*Chart) {
+	if l.pinned == nil {
+		l.pinned = make(map[string]bool)
+	}
+
+	for _, chart := range charts {
+		actual := l.lockedChart(chart)
+		l.pinned[actual.Chart] = true
+
+		if locked := l.find(actual.Chart); locked != nil {
+			*locked = actual
+		} else {
+			l.Charts = append(l.Charts, &actual)
+		}
+	}
+}
+
+// Write writes the lockfile with the charts pinned by Update, sorted by reference.
+func (l *Lockfile) Write() error {
+	l.Charts = slices.DeleteFunc(l.Charts, func(locked *LockedChart) bool {
+		return !l.pinned[locked.Chart]
+	})
+	slices.SortFunc(l.Charts, func(a, b *LockedChart) int {
+		return strings.Compare(a.Chart, b.Chart)
+	})
+
+	out, err := yaml.Marshal(l)
+	if err != nil {
+		return fmt.Errorf("error marshaling lockfile: %w", err)
+	}
+
+	header := "# This file is generated by helmer lock. Do not edit.\n"
+
+	return os.WriteFile(l.path, append([]byte(header), out...), 0644)
+}
+
+func (l *Lockfile) find(ref string) *LockedChart {
+	for _, locked := range l.Charts {
+		if locked.Chart == ref {
+			return locked
+		}
+	}
+
+	return nil
+}
+
+// lockedChart returns the lockfile entry for a loaded chart.
+func (l *Lockfile) lockedChart(chart *Chart) LockedChart {
+	ref := chart.resolved.source
+
+	// Local charts are stored relative to the lockfile so the lockfile can be committed along with the configs
+	if filepath.IsAbs(ref) {
+		lockDir, err := filepath.Abs(filepath.Dir(l.path))
+		if err == nil {
+			if relPath, err := filepath.Rel(lockDir, ref); err == nil {
+				ref = filepath.ToSlash(relPath)
+			}
+		}
+	}
+
+	return LockedChart{
+		Chart:   ref,
+		Version: chart.resolved.version,
+		Digest:  chart.resolved.digest,
+	}
+}
@@ -0,0 +1,101 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLockfileVerify(t *testing.T) {
+	dir := t.TempDir()
+	chartDir := filepath.Join(dir, "charts", "app")
+	if err := os.MkdirAll(chartDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: 0.1.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func() *Chart {
+		delete(resolvedCharts, chartDir)
+		c := &Chart{Path: "charts/app"}
+		if err := c.load(dir, 0); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+
+	lockPath := filepath.Join(dir, DefaultLockfile)
+	lock := NewLockfile(lockPath)
+	lock.Update([]*Chart{load()})
+	if err := lock.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := LoadLockfile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Charts) != 1 || lock.Charts[0].Chart != "charts/app" || lock.Charts[0].Version != "0.1.0" {
+		t.Fatalf("unexpected lockfile content %+v", lock.Charts)
+	}
+
+	if err := lock.Verify([]*Chart{load()}); err != nil {
+		t.Errorf("expected unchanged chart to match lockfile, got %v", err)
+	}
+
+	if err := os.WriteFile(filepath.Join(chartDir, "values.yaml"), []byte("colour: Blue\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := lock.Verify([]*Chart{load()}); err == nil {
+		t.Error("expected changed chart to not match lockfile")
+	}
+}
+
+func TestLockfileUpdateDropsRemovedCharts(t *testing.T) {
+	dir := t.TempDir()
+	chartDir := filepath.Join(dir, "charts", "app")
+	if err := os.MkdirAll(chartDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(chartDir, "Chart.yaml"), []byte("apiVersion: v2\nname: app\nversion: 0.2.0\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { delete(resolvedCharts, chartDir) })
+
+	lockPath := filepath.Join(dir, DefaultLockfile)
+	locked := `charts:
+  - chart: charts/app
+    version: 0.1.0
+    digest: sha256:0
+  - chart: charts/removed
+    version: 1.0.0
+    digest: sha256:1
+`
+	if err := os.WriteFile(lockPath, []byte(locked), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	lock, err := LoadLockfile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Chart{Path: "charts/app"}
+	if err := c.load(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	lock.Update([]*Chart{c})
+	if err := lock.Write(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the charts resolved in this run are kept
+	lock, err = LoadLockfile(lockPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lock.Charts) != 1 || lock.Charts[0].Chart != "charts/app" || lock.Charts[0].Version != "0.2.0" {
+		t.Errorf("expected only charts/app at version 0.2.0, got %+v", lock.Charts)
+	}
+}
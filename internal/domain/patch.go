@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 
 	"github.com/go-openapi/jsonreference"
@@ -13,20 +17,35 @@ import (
 )
 
 type Patch struct {
-	Target        PatchTarget     `yaml:"target"`
-	PatchJSON6902 yamlpatch.Patch `yaml:"patch"` // Note: yamlpatch.Patch is a slice of yamlpatch.Operation.
+	Name           string          `yaml:"name,omitempty"` // Used in error messages
+	Target         PatchTarget     `yaml:"target"`
+	PatchJSON6902  yamlpatch.Patch `yaml:"patch"`                    // Note: yamlpatch.Patch is a slice of yamlpatch.Operation.
+	StrategicMerge map[string]any  `yaml:"strategicMerge,omitempty"` // Partial object merged with Kubernetes strategic merge semantics
+	Merge          map[string]any  `yaml:"merge,omitempty"`          // JSON merge patch (RFC 7386)
 }
 
 type PatchTarget struct {
-	APIVersion string `yaml:"apiVersion,omitempty"`
-	Group      string `yaml:"group,omitempty"`
-	Version    string `yaml:"version,omitempty"`
-	Kind       string `yaml:"kind,omitempty"`
-	Name       string `yaml:"name,omitempty"`
-	Namespace  string `yaml:"namespace,omitempty"`
+	APIVersion         string `yaml:"apiVersion,omitempty"`
+	Group              string `yaml:"group,omitempty"`
+	Version            string `yaml:"version,omitempty"`
+	Kind               string `yaml:"kind,omitempty"`
+	Name               string `yaml:"name,omitempty"`               // Glob, or regular expression enclosed in slashes
+	Namespace          string `yaml:"namespace,omitempty"`          // Glob, or regular expression enclosed in slashes
+	LabelSelector      string `yaml:"labelSelector,omitempty"`      // Kubernetes label selector, e.g. tier=web,env in (dev,test)
+	AnnotationSelector string `yaml:"annotationSelector,omitempty"` // Label selector syntax, any annotation value allowed
 }
 
 func (p *Patch) Apply(manifests string, values map[string]any) (string, error) {
+	kinds := 0
+	for _, set := range []bool{len(p.PatchJSON6902) > 0, p.StrategicMerge != nil, p.Merge != nil} {
+		if set {
+			kinds++
+		}
+	}
+	if kinds != 1 {
+		return "", errors.New("a patch must have exactly one of patch, strategicMerge or merge")
+	}
+
 	result := bytes.NewBuffer(make([]byte, 0, len(manifests)))
 
 	docs := splitYAMLDocuments(manifests)
@@ -44,54 +63,71 @@ func (p *Patch) Apply(manifests string, values map[string]any) (string, error) {
 			return "", err
 		}
 
-		if matched {
-			var deReferencedPatch yamlpatch.Patch
+		if !matched {
+			result.Write(doc)
+			continue
+		}
 
-			for _, operation := range p.PatchJSON6902 {
-				if mapNode, ok := operation.Value.(map[string]any); ok {
-					if childNode, ok := mapNode["$ref"]; ok {
-						if ref, ok := childNode.(string); ok {
-							r, err := jsonreference.New(ref)
-							if err != nil {
-								return "", err
-							}
-
-							if r.HasFragmentOnly {
-								val, _, err := r.GetPointer().Get(values)
-								if err != nil {
-									return "", fmt.Errorf(`error evaluating reference "%v": %v`, ref, err)
-								}
-
-								deReferencedOperation := yamlpatch.Operation{
-									Type:    operation.Type,
-									Path:    operation.Path,
-									From:    operation.From,
-									Value:   val,
-									Comment: operation.Comment,
-								}
-
-								deReferencedPatch = append(deReferencedPatch, deReferencedOperation)
-							} else {
-								return "", errors.New(`$ref field in patch only supports /# style references`)
-							}
-						} else {
-							return "", errors.New(`$ref field must have string type`)
-						}
-					}
-				} else {
-					deReferencedPatch = append(deReferencedPatch, operation)
-				}
+		var patchedDoc []byte
+		switch {
+		case p.StrategicMerge != nil:
+			patch, err := resolvePatchRefs(p.StrategicMerge, values)
+			if err != nil {
+				return "", err
+			}
+
+			patchMap, ok := patch.(map[string]any)
+			if !ok {
+				return "", fmt.Errorf("strategicMerge must be an object, got %T", patch)
 			}
 
-			patchedDoc, err := yamlpatch.Apply(doc, deReferencedPatch)
+			patchedDoc, err = applyStrategicMerge(doc, yamlManifest, patchMap)
+			if err != nil {
+				return "", err
+			}
+		case p.Merge != nil:
+			patch, err := resolvePatchRefs(p.Merge, values)
 			if err != nil {
 				return "", err
 			}
 
-			result.Write(patchedDoc)
-		} else {
-			result.Write(doc)
+			patchMap, ok := patch.(map[string]any)
+			if !ok {
+				return "", fmt.Errorf("merge must be an object, got %T", patch)
+			}
+
+			patchedDoc, err = applyMergePatch(doc, yamlManifest, patchMap)
+			if err != nil {
+				return "", err
+			}
+		default:
+			// Operations are applied one by one, key selectors in paths are resolved against the document as patched so far
+			patchedDoc = doc
+			for _, operation := range p.PatchJSON6902 {
+				value, err := resolvePatchRefs(operation.Value, values)
+				if err != nil {
+					return "", err
+				}
+
+				path, from, err := resolveOperationPaths(operation, patchedDoc)
+				if err != nil {
+					return "", fmt.Errorf("%v: %w", resourceKeyOf(yamlManifest), err)
+				}
+
+				patchedDoc, err = yamlpatch.Apply(patchedDoc, yamlpatch.Patch{{
+					Type:    operation.Type,
+					Path:    path,
+					From:    from,
+					Value:   value,
+					Comment: operation.Comment,
+				}})
+				if err != nil {
+					return "", fmt.Errorf("%v: %w", resourceKeyOf(yamlManifest), err)
+				}
+			}
 		}
+
+		result.Write(patchedDoc)
 	}
 
 	// TODO check expected target value exists in the patched document and throw an error if not. This is to prevent silent failures where the patch is applied to the wrong document because the target selector is too broad or the template has changes unexpectedly.
@@ -99,7 +135,142 @@ func (p *Patch) Apply(manifests string, values map[string]any) (string, error) {
 	return result.String(), nil
 }
 
-// isTargetInManifest checks if the fragment exists in the document at root level.
+// resolvePatchRefs returns a copy of a patch value with every {$ref: "#/pointer"} replaced by the value it points at.
+func resolvePatchRefs(node any, values map[string]any) (any, error) {
+	switch node := node.(type) {
+	case map[string]any:
+		if childNode, ok := node["$ref"]; ok {
+			ref, ok := childNode.(string)
+			if !ok {
+				return nil, errors.New(`$ref field must have string type`)
+			}
+
+			r, err := jsonreference.New(ref)
+			if err != nil {
+				return nil, err
+			}
+			if !r.HasFragmentOnly {
+				return nil, errors.New(`$ref field in patch only supports /# style references`)
+			}
+
+			val, _, err := r.GetPointer().Get(values)
+			if err != nil {
+				return nil, fmt.Errorf(`error evaluating reference "%v": %v`, ref, err)
+			}
+
+			return val, nil
+		}
+
+		result := make(map[string]any, len(node))
+		for k, v := range node {
+			resolved, err := resolvePatchRefs(v, values)
+			if err != nil {
+				return nil, err
+			}
+			result[k] = resolved
+		}
+
+		return result, nil
+	case []any:
+		result := make([]any, len(node))
+		for i, v := range node {
+			resolved, err := resolvePatchRefs(v, values)
+			if err != nil {
+				return nil, err
+			}
+			result[i] = resolved
+		}
+
+		return result, nil
+	default:
+		return node, nil
+	}
+}
+
+// keySelector matches a path token selecting a list item by the value of one of its keys, e.g. [name=app].
+var keySelector = regexp.MustCompile(`^\[([^=\]]+)=(.*)\]$`)
+
+// resolveOperationPaths returns the path and from path of an operation with key selectors replaced by list indexes of doc.
+func resolveOperationPaths(operation yamlpatch.Operation, doc []byte) (yamlpatch.Path, yamlpatch.Path, error) {
+	if !hasKeySelector(operation.Path) && !hasKeySelector(operation.From) {
+		return operation.Path, operation.From, nil
+	}
+
+	var document any
+	if err := yaml.Unmarshal(doc, &document); err != nil {
+		return nil, nil, err
+	}
+
+	path, err := resolveKeySelectors(operation.Path, document)
+	if err != nil {
+		return nil, nil, err
+	}
+	from, err := resolveKeySelectors(operation.From, document)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return path, from, nil
+}
+
+func hasKeySelector(path yamlpatch.Path) bool {
+	return slices.ContainsFunc(path, keySelector.MatchString)
+}
+
+// resolveKeySelectors replaces each [key=value] token of a path with the index of the first item of the list at that
+// point whose key has the value. It is an error if no item matches.
+func resolveKeySelectors(path yamlpatch.Path, document any) (yamlpatch.Path, error) {
+	if !hasKeySelector(path) {
+		return path, nil
+	}
+
+	resolved := make(yamlpatch.Path, len(path))
+	node := document
+	for i, token := range path {
+		resolved[i] = token
+		if i == 0 {
+			continue // Empty token of the document root
+		}
+
+		if match := keySelector.FindStringSubmatch(token); match != nil {
+			list, ok := node.([]any)
+			if !ok {
+				return nil, fmt.Errorf("no list at %v", path[:i].String())
+			}
+
+			key, value := match[1], match[2]
+			index := slices.IndexFunc(list, func(item any) bool {
+				itemMap, ok := item.(map[string]any)
+				return ok && itemMap[key] != nil && fmt.Sprint(itemMap[key]) == value
+			})
+			if index < 0 {
+				return nil, fmt.Errorf("no item with %v=%v at %v", key, value, path[:i].String())
+			}
+
+			resolved[i] = strconv.Itoa(index)
+			node = list[index]
+			continue
+		}
+
+		switch n := node.(type) {
+		case map[string]any:
+			node = n[token]
+		case []any:
+			if index, err := strconv.Atoi(token); err == nil && index >= 0 && index < len(n) {
+				node = n[index]
+			} else {
+				node = nil
+			}
+		default:
+			node = nil
+		}
+	}
+
+	return resolved, nil
+}
+
+// isTargetInManifest checks if the document is selected by the target. The apiVersion and kind of the target must exist in
+// the document at root level, name and namespace must match as patterns and labels and annotations must match the selectors.
 func isTargetInManifest(document map[string]any, target PatchTarget) (bool, error) {
 	fragment := make(map[string]any)
 	if target.Group != "" {
@@ -120,17 +291,6 @@ func isTargetInManifest(document map[string]any, target PatchTarget) (bool, erro
 		fragment["kind"] = target.Kind
 	}
 
-	if target.Name != "" || target.Namespace != "" {
-		metadata := make(map[string]any)
-		if target.Name != "" {
-			metadata["name"] = target.Name
-		}
-		if target.Namespace != "" {
-			metadata["namespace"] = target.Namespace
-		}
-		fragment["metadata"] = metadata
-	}
-
 	changelog, err := diff.Diff(fragment, document)
 	if err != nil {
 		return false, err
@@ -144,9 +304,68 @@ func isTargetInManifest(document map[string]any, target PatchTarget) (bool, erro
 		}
 	}
 
+	metadata, _ := document["metadata"].(map[string]any)
+
+	for _, field := range []struct{ name, pattern string }{{"name", target.Name}, {"namespace", target.Namespace}} {
+		var value string
+		if metadata[field.name] != nil {
+			value = fmt.Sprint(metadata[field.name])
+		}
+
+		matched, err := matchPattern(field.pattern, value)
+		if err != nil {
+			return false, fmt.Errorf("target %v: %w", field.name, err)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+
+	for _, field := range []struct {
+		name, selector, metadataField string
+		parse                         func(string) (setSelector, error)
+	}{
+		{"labelSelector", target.LabelSelector, "labels", parseLabelSelector},
+		{"annotationSelector", target.AnnotationSelector, "annotations", parseAnnotationSelector},
+	} {
+		set, _ := metadata[field.metadataField].(map[string]any)
+
+		matched, err := matchSelector(field.selector, field.parse, set)
+		if err != nil {
+			return false, fmt.Errorf("target %v: %w", field.name, err)
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+
 	return true, nil
 }
 
+// matchPattern matches a value against a glob pattern, e.g. web-*, or a regular expression enclosed in slashes, e.g.
+// /^web-[0-9]+$/. An empty pattern matches any value.
+func matchPattern(pattern string, value string) (bool, error) {
+	if pattern == "" {
+		return true, nil
+	}
+
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return false, err
+		}
+
+		return re.MatchString(value), nil
+	}
+
+	matched, err := path.Match(pattern, value)
+	if err != nil {
+		return false, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+
+	return matched, nil
+}
+
 // splitYAMLDocuments splits a YAML string into separate documents based on the document separator "---".
 func splitYAMLDocuments(yamlContent string) [][]byte {
 	var docs [][]byte
@@ -0,0 +1,272 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/palantir/pkg/yamlpatch"
+)
+
+func TestPatchStrategicMerge(t *testing.T) {
+	manifests := `---
+# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: app:1.0
+        - name: sidecar
+          image: envoy:1.0
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+spec:
+  size: 1
+  tags:
+    - x
+`
+	patches := []*Patch{
+		{
+			Target: PatchTarget{Kind: "Deployment"},
+			StrategicMerge: map[string]any{"spec": map[string]any{"template": map[string]any{"spec": map[string]any{
+				"containers": []any{map[string]any{"name": "sidecar", "image": "envoy:2.0"}},
+			}}}},
+		},
+		{
+			Target:         PatchTarget{Kind: "Widget"},
+			StrategicMerge: map[string]any{"spec": map[string]any{"tags": []any{"y"}, "size": nil}},
+		},
+	}
+
+	result, err := applyPatches(manifests, patches, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs, err := parseResourceDocuments(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Containers are merged by name
+	expected := `# Source: app/templates/deployment.yaml
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+        - name: app
+          image: app:1.0
+        - name: sidecar
+          image: envoy:2.0
+`
+	if docs[0].content != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, docs[0].content)
+	}
+
+	// Custom resources get a JSON merge patch, replacing lists and deleting null fields
+	spec, _ := yaml.Marshal(docs[1].manifest["spec"])
+	if string(spec) != "tags:\n- \"y\"\n" {
+		t.Errorf("unexpected Widget spec %q", spec)
+	}
+}
+
+func TestPatchMerge(t *testing.T) {
+	manifests := `---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+  labels:
+    stale: "true"
+spec:
+  size: 1
+`
+	values := map[string]any{"widget": map[string]any{"size": 3}}
+	patches := []*Patch{
+		{
+			Target: PatchTarget{Kind: "Widget"},
+			Merge: map[string]any{
+				"metadata": map[string]any{"labels": map[string]any{"stale": nil, "team": "web"}},
+				"spec":     map[string]any{"size": map[string]any{"$ref": "#/widget/size"}},
+			},
+		},
+		{
+			Target:        PatchTarget{Kind: "Widget"},
+			PatchJSON6902: yamlpatch.Patch{{Type: "add", Path: yamlpatch.MustParsePath("/spec/selector"), Value: map[string]any{"app": "w"}}},
+		},
+	}
+
+	result, err := applyPatches(manifests, patches, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+  labels:
+    team: web
+spec:
+  size: 3
+  selector:
+    app: w
+`
+	docs, err := parseResourceDocuments(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if "---\n"+docs[0].content != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, docs[0].content)
+	}
+}
+
+func TestPatchKeySelector(t *testing.T) {
+	manifests := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  template:
+    spec:
+      containers:
+        - name: sidecar
+          image: envoy:1.0
+        - name: app
+          image: app:1.0
+          ports:
+            - containerPort: 8080
+`
+	patches := []*Patch{
+		{
+			Target: PatchTarget{Kind: "Deployment"},
+			PatchJSON6902: yamlpatch.Patch{
+				{Type: "replace", Path: yamlpatch.MustParsePath("/spec/template/spec/containers/[name=app]/image"), Value: "app:2.0"},
+				{Type: "remove", Path: yamlpatch.MustParsePath("/spec/template/spec/containers/[name=sidecar]")},
+				{Type: "replace", Path: yamlpatch.MustParsePath("/spec/template/spec/containers/[name=app]/ports/[containerPort=8080]/containerPort"), Value: 9090},
+			},
+		},
+	}
+
+	result, err := applyPatches(manifests, patches, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs, err := parseResourceDocuments(result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	containers, _ := yaml.Marshal(docs[0].manifest["spec"].(map[string]any)["template"].(map[string]any)["spec"].(map[string]any)["containers"])
+	expected := "- image: app:2.0\n  name: app\n  ports:\n  - containerPort: 9090\n"
+	if string(containers) != expected {
+		t.Errorf("expected\n%v\ngot\n%v", expected, string(containers))
+	}
+
+	// A selector matching no item is an error naming the patch and the resource
+	patches = []*Patch{
+		{
+			Name:          "image",
+			Target:        PatchTarget{Kind: "Deployment"},
+			PatchJSON6902: yamlpatch.Patch{{Type: "replace", Path: yamlpatch.MustParsePath("/spec/template/spec/containers/[name=web]/image"), Value: "web:2.0"}},
+		},
+	}
+
+	_, err = applyPatches(manifests, patches, nil)
+	if err == nil || !strings.Contains(err.Error(), "patch image: ") || !strings.Contains(err.Error(), "no item with name=web at /spec/template/spec/containers") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestIsTargetInManifest(t *testing.T) {
+	var document map[string]any
+	err := yaml.Unmarshal([]byte(`apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: release-name-web
+  namespace: shop
+  labels:
+    tier: web
+    env: dev
+  annotations:
+    example.com/owner: team-a
+    example.com/docs: https://example.com/docs/app?tab=1
+    description: The web shop front end
+`), &document)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for target, expected := range map[PatchTarget]bool{
+		{Kind: "Deployment", Name: "release-name-web"}:                                         true,
+		{Kind: "Deployment", Name: "*-web"}:                                                    true,
+		{Kind: "Deployment", Name: "*-api"}:                                                    false,
+		{Name: "/^release-name-(web|api)$/"}:                                                   true,
+		{Namespace: "sh?p"}:                                                                    true,
+		{Namespace: "/^default$/"}:                                                             false,
+		{Kind: "Service", LabelSelector: "tier=web"}:                                           false,
+		{LabelSelector: "tier=web"}:                                                            true,
+		{LabelSelector: "tier=web,env in (dev,test)"}:                                          true,
+		{LabelSelector: "env notin (dev),tier"}:                                                false,
+		{LabelSelector: "!canary"}:                                                             true,
+		{AnnotationSelector: "example.com/owner=team-a"}:                                       true,
+		{AnnotationSelector: "example.com/owner"}:                                              true,
+		{AnnotationSelector: "example.com/owner in (team-b)"}:                                  false,
+		{AnnotationSelector: "example.com/docs=https://example.com/docs/app?tab=1"}:            true,
+		{AnnotationSelector: "example.com/docs!=https://example.com/docs/app?tab=1"}:           false,
+		{AnnotationSelector: "example.com/docs in (https://example.com/docs/app?tab=1, none)"}: true,
+		{AnnotationSelector: "description==The web shop front end,!deprecated"}:                true,
+	} {
+		matched, err := isTargetInManifest(document, target)
+		if err != nil {
+			t.Errorf("%+v: %v", target, err)
+		}
+		if matched != expected {
+			t.Errorf("%+v: expected %v, got %v", target, expected, matched)
+		}
+	}
+
+	if _, err := isTargetInManifest(document, PatchTarget{LabelSelector: "tier in web"}); err == nil {
+		t.Error("expected error for invalid label selector")
+	}
+	if _, err := isTargetInManifest(document, PatchTarget{AnnotationSelector: "example.com/owner,,"}); err == nil {
+		t.Error("expected error for invalid annotation selector")
+	}
+}
+
+func TestPatchStrategicMergeNotAnObject(t *testing.T) {
+	manifests := "---\napiVersion: apps/v1\nkind: Deployment\nmetadata:\n  name: app\n"
+	values := map[string]any{"spec": "replicas: 2"}
+	patches := []*Patch{{Name: "replicas", Target: PatchTarget{Kind: "Deployment"}, StrategicMerge: map[string]any{"$ref": "#/spec"}}}
+
+	_, err := applyPatches(manifests, patches, values)
+	if err == nil || err.Error() != "patch replicas: strategicMerge must be an object, got string" {
+		t.Errorf("expected error for strategicMerge resolving to a string, got %v", err)
+	}
+}
+
+func TestPatchMergeNotAnObject(t *testing.T) {
+	manifests := "---\napiVersion: example.com/v1\nkind: Widget\nmetadata:\n  name: w\n"
+	patches := []*Patch{{Target: PatchTarget{Kind: "Widget"}, Merge: map[string]any{"$ref": "#/x"}}}
+
+	for _, x := range []any{"str", []any{"a"}} {
+		_, err := applyPatches(manifests, patches, map[string]any{"x": x})
+		if err == nil || !strings.HasPrefix(err.Error(), "patch #1: merge must be an object, got ") {
+			t.Errorf("expected error for merge resolving to %v, got %v", x, err)
+		}
+	}
+}
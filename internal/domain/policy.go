@@ -0,0 +1,197 @@
+package domain
+
+import (
+	"fmt"
+
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/ext"
+)
+
+// Policy severities
+const (
+	PolicyDeny = "deny" // Violations fail the run. This is the default.
+	PolicyWarn = "warn" // Violations are reported only.
+)
+
+// Policy is a rule every rendered object it targets must comply with.
+type Policy struct {
+	Name     string       `yaml:"name,omitempty"`
+	Target   *PatchTarget `yaml:"target,omitempty"` // Objects the policy applies to, all objects if not set
+	Rule     string       `yaml:"rule"`             // CEL expression evaluating to true if object complies
+	Message  string       `yaml:"message,omitempty"`
+	Severity string       `yaml:"severity,omitempty"`
+
+	program cel.Program
+}
+
+// PolicyViolation is a rendered object that doesn't comply with a policy.
+type PolicyViolation struct {
+	Policy    string
+	Severity  string
+	Message   string
+	TargetDir string
+	Resource  ResourceKey
+}
+
+func (v PolicyViolation) String() string {
+	return fmt.Sprintf("%v: %v: %v: policy %v: %v", v.Severity, v.TargetDir, v.Resource, v.Policy, v.Message)
+}
+
+// policyEnv is the CEL environment of policy rules. The rendered object is available as object.
+var policyEnv, policyEnvErr = cel.NewEnv(
+	cel.Variable("object", cel.DynType),
+	ext.Strings(),
+)
+
+// name returns the name of the policy, or its rule if it has no name.
+func (p *Policy) name() string {
+	if p.Name != "" {
+		return p.Name
+	}
+
+	return p.Rule
+}
+
+func (p *Policy) severity() (string, error) {
+	switch p.Severity {
+	case "":
+		return PolicyDeny, nil
+	case PolicyDeny, PolicyWarn:
+		return p.Severity, nil
+	default:
+		return "", fmt.Errorf("policy %v: unknown severity %q, must be one of %v or %v", p.name(), p.Severity, PolicyDeny, PolicyWarn)
+	}
+}
+
+// compile compiles the rule of the policy, once.
+func (p *Policy) compile() error {
+	if p.program != nil {
+		return nil
+	}
+	if policyEnvErr != nil {
+		return policyEnvErr
+	}
+
+	if p.Rule == "" {
+		return fmt.Errorf("policy %v has no rule", p.name())
+	}
+	if _, err := p.severity(); err != nil {
+		return err
+	}
+
+	ast, issues := policyEnv.Compile(p.Rule)
+	if issues != nil && issues.Err() != nil {
+		return fmt.Errorf("policy %v: error compiling rule:\n%w", p.name(), issues.Err())
+	}
+
+	program, err := policyEnv.Program(ast)
+	if err != nil {
+		return fmt.Errorf("policy %v: %w", p.name(), err)
+	}
+	p.program = program
+
+	return nil
+}
+
+// evaluate evaluates the policy against a rendered object. It returns a message if the object violates the policy.
+// A rule failing to evaluate, e.g. because a field it reads is missing, is a violation.
+func (p *Policy) evaluate(object map[string]any) (string, bool, error) {
+	if p.Target != nil {
+		matched, err := isTargetInManifest(object, *p.Target)
+		if err != nil {
+			return "", false, err
+		}
+		if !matched {
+			return "", false, nil
+		}
+	}
+
+	result, _, err := p.program.Eval(map[string]any{"object": object})
+	if err != nil {
+		return fmt.Sprintf("error evaluating rule: %v", err), true, nil
+	}
+
+	complies, ok := result.Value().(bool)
+	if !ok {
+		return "", false, fmt.Errorf("policy %v: rule must evaluate to a bool, got %v", p.name(), result.Type())
+	}
+	if complies {
+		return "", false, nil
+	}
+
+	if p.Message != "" {
+		return p.Message, true, nil
+	}
+
+	return fmt.Sprintf("rule %v not satisfied", p.Rule), true, nil
+}
+
+// globalPolicies returns the global policies of a document and its includes.
+func (d *Document) globalPolicies() []*Policy {
+	policies := append([]*Policy{}, d.Policies...)
+
+	for _, include := range d.Includes {
+		for _, loadedDoc := range include.loadedDocuments {
+			policies = append(policies, loadedDoc.globalPolicies()...)
+		}
+	}
+
+	return policies
+}
+
+// CheckPolicies evaluates the global policies of the document and its includes against every object rendered in the target,
+// and the policies of each chart against the objects of the chart. RenderTarget must be called first.
+func (d *Document) CheckPolicies() ([]PolicyViolation, error) {
+	if d.Target == nil {
+		return nil, nil
+	}
+
+	globalPolicies := d.globalPolicies()
+
+	var violations []PolicyViolation
+	for _, release := range d.Target.renderedReleases {
+		policies := globalPolicies
+		if release.chart != nil {
+			policies = append(append([]*Policy{}, globalPolicies...), release.chart.Policies...)
+		}
+		if len(policies) == 0 {
+			continue
+		}
+
+		for _, policy := range policies {
+			if err := policy.compile(); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, manifest := range []string{release.CRDsManifest, release.Release.Manifest, release.HooksManifest} {
+			docs, err := parseResourceDocuments(manifest)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing manifests of %v: %w", release.TargetDir, err)
+			}
+
+			for _, doc := range docs {
+				for _, policy := range policies {
+					message, violated, err := policy.evaluate(doc.manifest)
+					if err != nil {
+						return nil, fmt.Errorf("%v: %v: %w", release.TargetDir, doc.key, err)
+					}
+					if !violated {
+						continue
+					}
+
+					severity, _ := policy.severity()
+					violations = append(violations, PolicyViolation{
+						Policy:    policy.name(),
+						Severity:  severity,
+						Message:   message,
+						TargetDir: release.TargetDir,
+						Resource:  doc.key,
+					})
+				}
+			}
+		}
+	}
+
+	return violations, nil
+}
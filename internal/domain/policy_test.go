@@ -0,0 +1,56 @@
+package domain
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckPolicies(t *testing.T) {
+	manifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 1
+  template:
+    spec:
+      containers:
+        - name: app
+          image: nginx:latest
+---
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+`
+	doc := Document{
+		Target: &Target{Path: "prod"},
+		Policies: []*Policy{
+			{Name: "no-latest", Rule: `object.spec.template.spec.containers.all(c, !c.image.endsWith(":latest"))`, Target: &PatchTarget{Kind: "Deployment"}},
+			{Name: "replicas", Rule: `object.spec.replicas >= 2`, Severity: PolicyWarn, Target: &PatchTarget{Kind: "Deployment"}, Message: "at least 2 replicas"},
+			{Name: "named", Rule: `object.metadata.name.size() > 0`},
+			{Name: "limits", Rule: `object.spec.template.spec.containers.all(c, has(c.resources.limits))`, Severity: PolicyWarn, Target: &PatchTarget{Kind: "Deployment"}},
+		},
+	}
+	doc.Target.renderedReleases = []RenderedRelease{renderedRelease("app", manifest)}
+
+	violations, err := doc.CheckPolicies()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Rules evaluating to false are told apart from rules failing to evaluate by the message
+	var found []string
+	for _, violation := range violations {
+		found = append(found, violation.Severity+" "+violation.Policy+" "+violation.Resource.Kind+": "+violation.Message)
+	}
+	expected := []string{
+		`deny no-latest Deployment: rule object.spec.template.spec.containers.all(c, !c.image.endsWith(":latest")) not satisfied`,
+		"warn replicas Deployment: at least 2 replicas",
+		"warn limits Deployment: error evaluating rule: no such key: resources",
+	}
+	if strings.Join(found, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("expected violations\n%v\ngot\n%v", strings.Join(expected, "\n"), strings.Join(found, "\n"))
+	}
+}
@@ -0,0 +1,319 @@
+package domain
+
+import (
+	"fmt"
+	stdpath "path"
+	"strconv"
+	"strings"
+
+	"github.com/go-openapi/jsonpointer"
+	"github.com/goccy/go-yaml/ast"
+	"github.com/goccy/go-yaml/parser"
+	"helm.sh/helm/v4/pkg/chart/common/util"
+	chartv2 "helm.sh/helm/v4/pkg/chart/v2"
+)
+
+// valueSource records where a set of values was defined, to be able to explain where a value comes from.
+type valueSource struct {
+	kind   string
+	file   string
+	depth  int            // Include depth of the config file
+	values map[string]any // Values as written, before directives are resolved
+	lines  map[string]int // Line of each value, by JSON pointer relative to values
+}
+
+// Value source kinds, from lowest to highest precedence
+const (
+	sourceChartDefault = "chart default"
+	sourceGlobal       = "global values"
+	sourceChart        = "chart values"
+	sourceCommandLine  = "command line"
+	sourceChartFlag    = "--set-chart"
+)
+
+// valueDirectives are the keys of value nodes that are replaced by a value from somewhere else.
+var valueDirectives = []string{"$ref", "$file", "$files", "$env", "$sops"}
+
+// ValueCandidate is a value for a JSON pointer found in one of the value sources of a chart.
+type ValueCandidate struct {
+	Source    string // Kind of value source
+	File      string
+	Line      int
+	Depth     int    // Include depth, 0 for the config file given on the command line
+	Value     any    // Value as written in the source
+	Directive string // Set if the value comes from a directive like $ref or $env, the pointer the directive is at
+	Winner    bool   // The candidate with the highest precedence
+
+	RefChain []ValueCandidate // For a local $ref, the candidates of the referenced value
+}
+
+// ValueExplanation tells which value a chart gets for a JSON pointer, and where it comes from.
+type ValueExplanation struct {
+	Chart      string
+	TargetDir  string
+	Pointer    string
+	Value      any
+	Found      bool
+	Candidates []ValueCandidate // Ordered from highest to lowest precedence
+}
+
+// newValueSource copies values before directives are resolved and looks up the line of every value.
+// valuesPointer is the JSON pointer of the values within the config file.
+func newValueSource(kind string, file string, depth int, values map[string]any, lines map[string]int, valuesPointer string) *valueSource {
+	source := &valueSource{kind: kind, file: file, depth: depth, values: copyValues(values), lines: make(map[string]int)}
+
+	for pointer, line := range lines {
+		if pointer == valuesPointer || strings.HasPrefix(pointer, valuesPointer+"/") {
+			source.lines[strings.TrimPrefix(pointer, valuesPointer)] = line
+		}
+	}
+
+	return source
+}
+
+// copyValues returns a deep copy of values.
+func copyValues(values map[string]any) map[string]any {
+	if values == nil {
+		return nil
+	}
+
+	var copyNode func(node any) any
+	copyNode = func(node any) any {
+		switch node := node.(type) {
+		case map[string]any:
+			result := make(map[string]any, len(node))
+			for k, v := range node {
+				result[k] = copyNode(v)
+			}
+			return result
+		case []any:
+			result := make([]any, len(node))
+			for i, v := range node {
+				result[i] = copyNode(v)
+			}
+			return result
+		default:
+			return node
+		}
+	}
+
+	return copyNode(values).(map[string]any)
+}
+
+// yamlLines returns the line of every node in a YAML document, by JSON pointer.
+func yamlLines(content []byte) map[string]int {
+	lines := make(map[string]int)
+
+	file, err := parser.ParseBytes(content, 0)
+	if err != nil || len(file.Docs) == 0 {
+		return lines
+	}
+
+	var walk func(node ast.Node, pointer string)
+	walk = func(node ast.Node, pointer string) {
+		switch node := node.(type) {
+		case *ast.MappingNode:
+			for _, value := range node.Values {
+				walk(value, pointer)
+			}
+		case *ast.MappingValueNode:
+			key, ok := node.Key.(ast.ScalarNode)
+			if !ok {
+				return
+			}
+			keyPointer := pointer + "/" + jsonpointer.Escape(fmt.Sprint(key.GetValue()))
+			lines[keyPointer] = node.Key.GetToken().Position.Line
+			walk(node.Value, keyPointer)
+		case *ast.SequenceNode:
+			for i, value := range node.Values {
+				itemPointer := pointer + "/" + strconv.Itoa(i)
+				lines[itemPointer] = value.GetToken().Position.Line
+				walk(value, itemPointer)
+			}
+		case *ast.AnchorNode:
+			walk(node.Value, pointer)
+		case *ast.TagNode:
+			walk(node.Value, pointer)
+		}
+	}
+	walk(file.Docs[0].Body, "")
+
+	return lines
+}
+
+// lookup finds the value at pointer in the source. If a directive is found on the way, the directive is returned along with
+// the pointer it is at, as the directive replaces everything below it.
+func (s *valueSource) lookup(pointer string) (ValueCandidate, bool) {
+	candidate := ValueCandidate{Source: s.kind, File: s.file, Depth: s.depth}
+
+	ptr, err := jsonpointer.New(pointer)
+	if err != nil {
+		return ValueCandidate{}, false
+	}
+
+	var node any = s.values
+	current := ""
+	for _, token := range ptr.DecodedTokens() {
+		if mapNode, ok := node.(map[string]any); ok && isDirective(mapNode) {
+			break
+		}
+
+		switch n := node.(type) {
+		case map[string]any:
+			value, ok := n[token]
+			if !ok {
+				return ValueCandidate{}, false
+			}
+			node = value
+		case []any:
+			i, err := strconv.Atoi(token)
+			if err != nil || i < 0 || i >= len(n) {
+				return ValueCandidate{}, false
+			}
+			node = n[i]
+		default:
+			return ValueCandidate{}, false
+		}
+		current += "/" + jsonpointer.Escape(token)
+	}
+
+	if mapNode, ok := node.(map[string]any); ok && isDirective(mapNode) {
+		candidate.Directive = current
+	}
+
+	candidate.Value = node
+	candidate.Line = s.lines[current]
+
+	return candidate, true
+}
+
+func isDirective(node map[string]any) bool {
+	for _, directive := range valueDirectives {
+		if _, ok := node[directive]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// globalValueSources returns the sources of the global values of a document and its includes, from highest to lowest precedence.
+// Values of a config take precedence over the values of the configs it includes, and earlier includes over later ones.
+func (d *Document) globalValueSources() []*valueSource {
+	var sources []*valueSource
+	if d.valueSource != nil {
+		sources = append(sources, d.valueSource)
+	}
+
+	for _, include := range d.Includes {
+		for _, loadedDoc := range include.loadedDocuments {
+			sources = append(sources, loadedDoc.globalValueSources()...)
+		}
+	}
+
+	return sources
+}
+
+// chartValueSources returns the value sources of a chart, from highest to lowest precedence.
+func (d *Document) chartValueSources(c *Chart) []*valueSource {
+	var sources []*valueSource
+
+	if values, ok := GlobalValueOverrides.Charts[c.TargetDir]; ok {
+		sources = append(sources, &valueSource{kind: sourceChartFlag, values: values})
+	}
+	if len(GlobalValueOverrides.Values) > 0 {
+		sources = append(sources, &valueSource{kind: sourceCommandLine, values: GlobalValueOverrides.Values})
+	}
+	if c.valueSource != nil {
+		sources = append(sources, c.valueSource)
+	}
+	sources = append(sources, d.globalValueSources()...)
+
+	if ch, ok := c.resolved.charter.(*chartv2.Chart); ok {
+		source := &valueSource{kind: sourceChartDefault, file: stdpath.Join(c.String(), "values.yaml"), values: ch.Values, lines: map[string]int{}}
+		for _, file := range ch.Raw {
+			if file.Name == "values.yaml" {
+				source.lines = yamlLines(file.Data)
+			}
+		}
+		sources = append(sources, source)
+	}
+
+	return sources
+}
+
+// ExplainValue explains where the value at a JSON pointer comes from for each chart of the document with the given targetDir,
+// or for all charts if targetDir is empty.
+func (d *Document) ExplainValue(targetDir string, pointer string) ([]ValueExplanation, error) {
+	pointer = strings.TrimPrefix(pointer, "#")
+	ptr, err := jsonpointer.New(pointer)
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON pointer %q: %w", pointer, err)
+	}
+
+	if err := d.setHelmerValues(); err != nil {
+		return nil, err
+	}
+
+	var explanations []ValueExplanation
+	for _, c := range d.CollectCharts() {
+		if targetDir != "" && c.TargetDir != targetDir {
+			continue
+		}
+
+		explanation := ValueExplanation{Chart: c.String(), TargetDir: c.TargetDir, Pointer: pointer}
+
+		values, err := util.CoalesceValues(c.resolved.charter, GlobalValueOverrides.chartValues(c))
+		if err != nil {
+			return nil, fmt.Errorf("chart %v: %w", c, err)
+		}
+		value, _, err := ptr.Get(map[string]any(values))
+		if err == nil {
+			explanation.Value = value
+			explanation.Found = true
+		}
+
+		explanation.Candidates = d.valueCandidates(d.chartValueSources(c), pointer, 0)
+
+		explanations = append(explanations, explanation)
+	}
+
+	if len(explanations) == 0 && targetDir != "" {
+		return nil, fmt.Errorf("no chart with targetDir %v", targetDir)
+	}
+
+	return explanations, nil
+}
+
+// maxRefDepth limits how deep chains of $ref are followed.
+const maxRefDepth = 10
+
+// valueCandidates looks up pointer in each source. Local $ref directives are followed into the global values they point at.
+func (d *Document) valueCandidates(sources []*valueSource, pointer string, refDepth int) []ValueCandidate {
+	var candidates []ValueCandidate
+	for _, source := range sources {
+		candidate, ok := source.lookup(pointer)
+		if !ok {
+			continue
+		}
+
+		if directive, ok := candidate.Value.(map[string]any); ok && candidate.Directive != "" && refDepth < maxRefDepth {
+			if ref, ok := directive["$ref"].(string); ok && strings.HasPrefix(ref, "#") {
+				// The part of pointer below the directive is looked up below the referenced value
+				refPointer := strings.TrimPrefix(ref, "#") + strings.TrimPrefix(pointer, candidate.Directive)
+				candidate.RefChain = d.valueCandidates(d.globalValueSources(), refPointer, refDepth+1)
+				if len(candidate.RefChain) > 0 {
+					candidate.RefChain[0].Winner = true
+				}
+			}
+		}
+
+		candidates = append(candidates, candidate)
+	}
+
+	if len(candidates) > 0 {
+		candidates[0].Winner = true
+	}
+
+	return candidates
+}
@@ -0,0 +1,170 @@
+package domain
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+)
+
+func TestValueSourceLookup(t *testing.T) {
+	content := []byte(`charts:
+  - path: app
+    values:
+      image:
+        tag: v1
+      hosts:
+        - a.example.com
+        - b.example.com
+      password:
+        $env: PASSWORD
+`)
+
+	var doc Document
+	if err := yaml.Unmarshal(content, &doc); err != nil {
+		t.Fatal(err)
+	}
+	source := newValueSource(sourceChart, "config.yaml", 0, doc.Charts[0].Values, yamlLines(content), "/charts/0/values")
+
+	tests := []struct {
+		pointer   string
+		value     any
+		line      int
+		directive string
+	}{
+		{"/image/tag", "v1", 5, ""},
+		{"/hosts/1", "b.example.com", 8, ""},
+		{"/password/length", map[string]any{"$env": "PASSWORD"}, 9, "/password"},
+	}
+	for _, test := range tests {
+		candidate, ok := source.lookup(test.pointer)
+		if !ok {
+			t.Errorf("%v: not found", test.pointer)
+			continue
+		}
+		if yamlString(t, candidate.Value) != yamlString(t, test.value) || candidate.Line != test.line || candidate.Directive != test.directive {
+			t.Errorf("%v: expected %v at line %v directive %q, got %v at line %v directive %q", test.pointer, test.value, test.line, test.directive, candidate.Value, candidate.Line, candidate.Directive)
+		}
+	}
+
+	if _, ok := source.lookup("/image/repository"); ok {
+		t.Errorf("/image/repository: expected not found")
+	}
+}
+
+func yamlString(t *testing.T, value any) string {
+	t.Helper()
+
+	out, err := yaml.Marshal(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(out)
+}
+
+func TestExplainValue(t *testing.T) {
+	files := map[string]string{
+		"charts/app/Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+		"charts/app/values.yaml": "a: default\nb: default\nc: default\nd: default\ne: default\nf: default\n",
+		"prod.yaml": `includes:
+  - path: base.yaml
+charts:
+  - path: charts/app
+    targetDir: web
+    values:
+      a: chart
+      b: chart
+      c: chart
+      db:
+        $ref: "#/shared/db"
+values:
+  a: global
+  b: global
+  c: global
+  d: global
+  shared:
+    db:
+      $ref: "#/defaults/db"
+`,
+		"base.yaml": `values:
+  a: base
+  b: base
+  c: base
+  d: base
+  e: base
+  defaults:
+    db:
+      host: postgres
+`,
+	}
+	overrides := ValueOverrides{
+		Values: Values{"a": "set", "b": "set"},
+		Charts: map[string]Values{"web": {"a": "set-chart"}},
+	}
+	doc := loadTestConfig(t, files, "prod.yaml", overrides)
+
+	// Each candidate as source file:line=value, the winner marked with *
+	describe := func(candidates []ValueCandidate) []string {
+		var result []string
+		for _, candidate := range candidates {
+			description := fmt.Sprintf("%v %v:%v=%v", candidate.Source, candidate.File, candidate.Line, candidate.Value)
+			if candidate.Winner {
+				description = "*" + description
+			}
+			result = append(result, description)
+		}
+		return result
+	}
+
+	for _, test := range []struct {
+		pointer    string
+		value      any
+		candidates []string
+	}{
+		{"/a", "set-chart", []string{"*--set-chart :0=set-chart", "command line :0=set", "chart values prod.yaml:7=chart", "global values prod.yaml:13=global", "global values base.yaml:2=base", "chart default charts/app/values.yaml:1=default"}},
+		{"/b", "set", []string{"*command line :0=set", "chart values prod.yaml:8=chart", "global values prod.yaml:14=global", "global values base.yaml:3=base", "chart default charts/app/values.yaml:2=default"}},
+		{"/c", "chart", []string{"*chart values prod.yaml:9=chart", "global values prod.yaml:15=global", "global values base.yaml:4=base", "chart default charts/app/values.yaml:3=default"}},
+		{"/d", "global", []string{"*global values prod.yaml:16=global", "global values base.yaml:5=base", "chart default charts/app/values.yaml:4=default"}},
+		{"/e", "base", []string{"*global values base.yaml:6=base", "chart default charts/app/values.yaml:5=default"}},
+		{"/f", "default", []string{"*chart default charts/app/values.yaml:6=default"}},
+	} {
+		explanations, err := doc.ExplainValue("web", test.pointer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(explanations) != 1 || !explanations[0].Found || explanations[0].Value != test.value {
+			t.Errorf("%v: expected value %v, got %+v", test.pointer, test.value, explanations)
+			continue
+		}
+		if candidates := describe(explanations[0].Candidates); !reflect.DeepEqual(candidates, test.candidates) {
+			t.Errorf("%v: expected candidates\n%v\ngot\n%v", test.pointer, strings.Join(test.candidates, "\n"), strings.Join(candidates, "\n"))
+		}
+	}
+
+	// Local $ref directives are followed through the global values, below the pointer of the directive
+	explanations, err := doc.ExplainValue("web", "/db/host")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(explanations) != 1 || explanations[0].Value != "postgres" {
+		t.Fatalf("expected value postgres, got %+v", explanations)
+	}
+	chart := explanations[0].Candidates
+	if len(chart) != 1 || chart[0].Directive != "/db" || chart[0].Line != 10 || len(chart[0].RefChain) != 1 {
+		t.Fatalf("expected the $ref of the chart values, got %+v", chart)
+	}
+	shared := chart[0].RefChain[0]
+	if shared.File != "prod.yaml" || shared.Directive != "/shared/db" || shared.Line != 18 || len(shared.RefChain) != 1 {
+		t.Fatalf("expected the $ref of the global values, got %+v", shared)
+	}
+	if expected := []string{"*global values base.yaml:9=postgres"}; !reflect.DeepEqual(describe(shared.RefChain), expected) {
+		t.Errorf("expected the referenced value %v, got %v", expected, describe(shared.RefChain))
+	}
+
+	if _, err := doc.ExplainValue("api", "/a"); err == nil {
+		t.Error("expected error for unknown targetDir")
+	}
+}
@@ -0,0 +1,121 @@
+package domain
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/stefan65535/helmer/internal/logger"
+	"helm.sh/helm/v4/pkg/chart"
+	"helm.sh/helm/v4/pkg/chart/loader"
+	"helm.sh/helm/v4/pkg/registry"
+)
+
+// RegistrySettings controls how charts are pulled from OCI registries.
+type RegistrySettings struct {
+	CredentialsFile string // Registry config file. If not set the Helm registry config is used with fallback to the Docker config.
+	PlainHTTP       bool   // Use plain HTTP instead of HTTPS.
+}
+
+var GlobalRegistrySettings RegistrySettings
+
+// Environment variables holding basic auth credentials for OCI registries. When set they take precedence over credential files.
+const (
+	registryUsernameEnv = "HELMER_REGISTRY_USERNAME"
+	registryPasswordEnv = "HELMER_REGISTRY_PASSWORD"
+)
+
+// registryClient is created on first use and shared by all OCI charts.
+var registryClient *registry.Client
+
+func getRegistryClient() (*registry.Client, error) {
+	if registryClient != nil {
+		return registryClient, nil
+	}
+
+	options := []registry.ClientOption{
+		registry.ClientOptEnableCache(true),
+	}
+	if GlobalRegistrySettings.CredentialsFile != "" {
+		options = append(options, registry.ClientOptCredentialsFile(GlobalRegistrySettings.CredentialsFile))
+	}
+	if GlobalRegistrySettings.PlainHTTP {
+		options = append(options, registry.ClientOptPlainHTTP())
+	}
+	if username, password := os.Getenv(registryUsernameEnv), os.Getenv(registryPasswordEnv); username != "" && password != "" {
+		options = append(options, registry.ClientOptBasicAuth(username, password))
+	}
+
+	client, err := registry.NewClient(options...)
+	if err != nil {
+		return nil, fmt.Errorf("error creating registry client: %w", err)
+	}
+	registryClient = client
+
+	return registryClient, nil
+}
+
+// pullOCIChart pulls a chart from an OCI registry and loads it. Charts already in the chart cache are not pulled again.
+// The reference may contain a tag or digest. The version may be an exact version or a semver constraint
+// matched against the tags in the repository. If neither is given the highest version is used.
+// It returns the loaded chart and the digest of the pulled manifest.
+func pullOCIChart(ref string, version string, indent int) (chart.Charter, string, error) {
+	client, err := getRegistryClient()
+	if err != nil {
+		return nil, "", err
+	}
+
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid chart reference %v: %w", ref, err)
+	}
+
+	_, u, err = client.ValidateReference(ref, version, u)
+	if err != nil {
+		return nil, "", fmt.Errorf("error resolving chart %v: %w", ref, err)
+	}
+
+	pullRef := u.Host + "/" + strings.TrimPrefix(u.Path, "/")
+
+	desc, err := client.Resolve(pullRef)
+	if err != nil {
+		return nil, "", fmt.Errorf("error resolving chart %v: %w", pullRef, err)
+	}
+	digest := desc.Digest.String()
+
+	// The manifest digest is registered as an alias of the chart archive in the cache
+	archive, cached, err := GlobalChartCache.Get(digest)
+	if err != nil {
+		return nil, "", err
+	}
+
+	if cached {
+		logger.Verbosef(indent, "Using cached chart %v", digest)
+	} else {
+		logger.Verbosef(indent, "Pulling chart %v", pullRef)
+		result, err := client.Pull(pullRef)
+		if err != nil {
+			return nil, "", fmt.Errorf("error pulling chart %v: %w", pullRef, err)
+		}
+		archive = result.Chart.Data
+		digest = result.Manifest.Digest
+
+		cachedChart := CachedChart{Source: pullRef}
+		if result.Chart.Meta != nil {
+			cachedChart.Name = result.Chart.Meta.Name
+			cachedChart.Version = result.Chart.Meta.Version
+		}
+		if _, err := GlobalChartCache.Put(archive, cachedChart, digest); err != nil {
+			return nil, "", fmt.Errorf("error caching chart %v: %w", pullRef, err)
+		}
+	}
+
+	charter, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, "", fmt.Errorf("error loading chart %v:\n%w", pullRef, err)
+	}
+
+	return charter, digest, nil
+}
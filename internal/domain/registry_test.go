@@ -0,0 +1,140 @@
+package domain
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v4/pkg/registry"
+)
+
+// ociRegistry starts a read-only OCI distribution server holding a single chart tagged 1.2.3.
+// If username is set the server requires basic auth.
+func ociRegistry(t *testing.T, archive []byte, username string, password string) *httptest.Server {
+	t.Helper()
+
+	digestOf := func(data []byte) string {
+		return fmt.Sprintf("sha256:%x", sha256.Sum256(data))
+	}
+
+	config := []byte(`{"apiVersion":"v2","name":"mychart","version":"1.2.3"}`)
+	manifest, err := json.Marshal(map[string]any{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"config": map[string]any{
+			"mediaType": registry.ConfigMediaType,
+			"digest":    digestOf(config),
+			"size":      len(config),
+		},
+		"layers": []any{
+			map[string]any{
+				"mediaType": registry.ChartLayerMediaType,
+				"digest":    digestOf(archive),
+				"size":      len(archive),
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	blobs := map[string][]byte{
+		digestOf(config):  config,
+		digestOf(archive): archive,
+	}
+
+	serve := func(w http.ResponseWriter, r *http.Request, contentType string, data []byte) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Docker-Content-Digest", digestOf(data))
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		if r.Method != http.MethodHead {
+			w.Write(data)
+		}
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); username != "" && (!ok || user != username || pass != password) {
+			w.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch path := r.URL.Path; {
+		case path == "/v2/":
+			w.WriteHeader(http.StatusOK)
+		case path == "/v2/mychart/tags/list":
+			serve(w, r, "application/json", []byte(`{"name":"mychart","tags":["1.2.3"]}`))
+		case path == "/v2/mychart/manifests/1.2.3" || path == "/v2/mychart/manifests/"+digestOf(manifest):
+			serve(w, r, "application/vnd.oci.image.manifest.v1+json", manifest)
+		case strings.HasPrefix(path, "/v2/mychart/blobs/"):
+			blob, ok := blobs[strings.TrimPrefix(path, "/v2/mychart/blobs/")]
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			serve(w, r, "application/octet-stream", blob)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// useRegistrySettings replaces the registry settings and client for the duration of a test.
+func useRegistrySettings(t *testing.T, settings RegistrySettings) {
+	t.Helper()
+
+	previous := GlobalRegistrySettings
+	GlobalRegistrySettings = settings
+	registryClient = nil
+	t.Cleanup(func() {
+		GlobalRegistrySettings = previous
+		registryClient = nil
+	})
+}
+
+func TestChartLoadFromOCI(t *testing.T) {
+	useChartCache(t)
+	useRegistrySettings(t, RegistrySettings{PlainHTTP: true})
+	server := ociRegistry(t, chartArchive(t, "mychart", "1.2.3"), "", "")
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	for _, c := range []*Chart{
+		{Path: "oci://" + host + "/mychart", Version: "1.2.3"},
+		{Path: "oci://" + host + "/mychart", Version: "^1.0.0"},
+		{Path: "oci://" + host + "/mychart:1.2.3"},
+	} {
+		if err := c.load(".", 0); err != nil {
+			t.Fatalf("%v: %v", c, err)
+		}
+		if c.TargetDir != "mychart" {
+			t.Errorf("%v: expected target dir mychart, got %v", c, c.TargetDir)
+		}
+	}
+}
+
+func TestChartLoadFromOCIWithBasicAuth(t *testing.T) {
+	useChartCache(t)
+	useRegistrySettings(t, RegistrySettings{PlainHTTP: true, CredentialsFile: t.TempDir() + "/config.json"})
+	server := ociRegistry(t, chartArchive(t, "mychart", "1.2.3"), "user", "secret")
+	host := strings.TrimPrefix(server.URL, "http://")
+
+	c := &Chart{Path: "oci://" + host + "/mychart", Version: "1.2.3"}
+	if err := c.load(".", 0); err == nil {
+		t.Fatal("expected pull without credentials to fail")
+	}
+
+	t.Setenv(registryUsernameEnv, "user")
+	t.Setenv(registryPasswordEnv, "secret")
+	registryClient = nil
+
+	if err := c.load(".", 0); err != nil {
+		t.Fatal(err)
+	}
+}
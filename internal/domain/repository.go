@@ -0,0 +1,127 @@
+package domain
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/stefan65535/helmer/internal/logger"
+	"helm.sh/helm/v4/pkg/chart"
+	"helm.sh/helm/v4/pkg/chart/loader"
+	repo "helm.sh/helm/v4/pkg/repo/v1"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// indexCache holds repository index files already downloaded by this process, keyed by repository URL.
+var indexCache = make(map[string]*repo.IndexFile)
+
+// httpClient downloads from chart repositories. A repository that stops responding fails the download instead of hanging.
+var httpClient = &http.Client{Timeout: 2 * time.Minute}
+
+// fetchRepoChart downloads a chart from a Helm chart repository, verifies its digest against the repository index and loads it.
+// Charts already in the chart cache are not downloaded again.
+// The version may be an exact version or a semver constraint. If empty the latest stable version is used.
+// It returns the loaded chart, its index entry and its digest.
+func fetchRepoChart(repoURL string, name string, version string, indent int) (chart.Charter, *repo.ChartVersion, string, error) {
+	index, err := loadRepoIndex(repoURL, indent)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	chartVersion, err := index.Get(name, version)
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("chart %v version %q not found in repository %v: %w", name, version, repoURL, err)
+	}
+
+	if len(chartVersion.URLs) == 0 {
+		return nil, nil, "", fmt.Errorf("chart %v version %v in repository %v has no download URL", name, chartVersion.Version, repoURL)
+	}
+
+	chartURL, err := repo.ResolveReferenceURL(repoURL, chartVersion.URLs[0])
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if chartVersion.Digest == "" {
+		return nil, nil, "", fmt.Errorf("chart %v in repository %v has no digest to verify the chart against", name, repoURL)
+	}
+	digest := chartVersion.Digest
+	if !strings.HasPrefix(digest, "sha256:") {
+		digest = "sha256:" + digest
+	}
+
+	archive, cached, err := GlobalChartCache.Get(digest)
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	if cached {
+		logger.Verbosef(indent, "Using cached chart %v", digest)
+	} else {
+		logger.Verbosef(indent, "Downloading chart %v", chartURL)
+		archive, err = httpGet(chartURL)
+		if err != nil {
+			return nil, nil, "", err
+		}
+
+		if actual := digestOf(archive); actual != digest {
+			return nil, nil, "", fmt.Errorf("chart %v downloaded from %v: digest mismatch, expected %v got %v", name, chartURL, digest, actual)
+		}
+
+		if _, err := GlobalChartCache.Put(archive, CachedChart{Name: name, Version: chartVersion.Version, Source: chartURL}); err != nil {
+			return nil, nil, "", fmt.Errorf("error caching chart %v: %w", name, err)
+		}
+	}
+
+	charter, err := loader.LoadArchive(bytes.NewReader(archive))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("error loading chart %v downloaded from %v:\n%w", name, chartURL, err)
+	}
+
+	return charter, chartVersion, digest, nil
+}
+
+// loadRepoIndex downloads and parses the index.yaml of a chart repository.
+func loadRepoIndex(repoURL string, indent int) (*repo.IndexFile, error) {
+	if index, ok := indexCache[repoURL]; ok {
+		return index, nil
+	}
+
+	indexURL := strings.TrimSuffix(repoURL, "/") + "/index.yaml"
+
+	logger.Verbosef(indent, "Downloading repository index %v", indexURL)
+	data, err := httpGet(indexURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var index repo.IndexFile
+	if err := sigsyaml.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("error decoding repository index %v:\n%w", indexURL, err)
+	}
+	if index.APIVersion == "" {
+		return nil, fmt.Errorf("repository index %v has no apiVersion", indexURL)
+	}
+	index.SortEntries()
+
+	indexCache[repoURL] = &index
+
+	return &index, nil
+}
+
+func httpGet(url string) ([]byte, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %v failed: %v", url, resp.Status)
+	}
+
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,113 @@
+package domain
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"helm.sh/helm/v4/pkg/chart"
+)
+
+// chartArchive builds a minimal gzipped chart archive.
+func chartArchive(t *testing.T, name string, version string) []byte {
+	t.Helper()
+
+	files := map[string]string{
+		name + "/Chart.yaml":               fmt.Sprintf("apiVersion: v2\nname: %v\nversion: %v\n", name, version),
+		name + "/values.yaml":              "colour: Blue\n",
+		name + "/templates/configmap.yaml": "apiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: {{ .Release.Name }}\ndata:\n  colour: {{ .Values.colour }}\n",
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for fileName, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: fileName, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+// chartRepository starts a HTTP server serving an index.yaml and a single chart archive.
+// If digest is empty the digest of the archive is used.
+func chartRepository(t *testing.T, archive []byte, digest string) *httptest.Server {
+	t.Helper()
+
+	if digest == "" {
+		sum := sha256.Sum256(archive)
+		digest = hex.EncodeToString(sum[:])
+	}
+
+	index := fmt.Sprintf(`apiVersion: v1
+entries:
+  mychart:
+    - apiVersion: v2
+      name: mychart
+      version: 1.2.3
+      digest: %v
+      urls:
+        - charts/mychart-1.2.3.tgz
+`, digest)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/index.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(index))
+	})
+	mux.HandleFunc("/charts/mychart-1.2.3.tgz", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive)
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestChartLoadFromRepo(t *testing.T) {
+	useChartCache(t)
+	server := chartRepository(t, chartArchive(t, "mychart", "1.2.3"), "")
+
+	c := Chart{Repo: server.URL, Name: "mychart", Version: "1.2.3"}
+	if err := c.load(".", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	accessor, err := chart.NewAccessor(c.resolved.charter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accessor.Name() != "mychart" {
+		t.Errorf("expected chart mychart, got %v", accessor.Name())
+	}
+	if c.TargetDir != "mychart" {
+		t.Errorf("expected target dir mychart, got %v", c.TargetDir)
+	}
+}
+
+func TestChartLoadFromRepoDigestMismatch(t *testing.T) {
+	useChartCache(t)
+	server := chartRepository(t, chartArchive(t, "mychart", "1.2.3"), strings.Repeat("0", 64))
+
+	c := Chart{Repo: server.URL, Name: "mychart", Version: "1.2.3"}
+	if err := c.load(".", 0); err == nil {
+		t.Fatal("expected digest mismatch error")
+	}
+}
@@ -0,0 +1,212 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"helm.sh/helm/v4/pkg/chart"
+	"helm.sh/helm/v4/pkg/chart/common/util"
+)
+
+// SchemaViolation is a chart value that doesn't validate against the values.schema.json of the chart.
+type SchemaViolation struct {
+	Chart   string
+	Pointer string // JSON pointer to the value within the chart values
+	Message string
+	Source  string // Kind of value source the value comes from, empty if no source defines it
+	File    string
+	Line    int
+}
+
+func (v SchemaViolation) String() string {
+	location := v.Source
+	if v.File != "" {
+		location = v.File
+		if v.Line > 0 {
+			location = fmt.Sprintf("%v:%v", v.File, v.Line)
+		}
+	}
+	if location == "" {
+		location = "not set"
+	}
+
+	pointer := v.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+
+	return fmt.Sprintf("chart %v: %v (%v): %v", v.Chart, pointer, location, v.Message)
+}
+
+var schemaMessagePrinter = message.NewPrinter(language.English)
+
+// ValidateValues validates the values of every chart of the document against the values.schema.json of the chart and its
+// subcharts, like Helm does before rendering. All violations are returned, each with the config file and line the offending
+// value is set at.
+func (d *Document) ValidateValues() ([]SchemaViolation, error) {
+	if err := d.setHelmerValues(); err != nil {
+		return nil, err
+	}
+
+	var violations []SchemaViolation
+	for _, c := range d.CollectCharts() {
+		values, err := util.CoalesceValues(c.resolved.charter, GlobalValueOverrides.chartValues(c))
+		if err != nil {
+			return nil, fmt.Errorf("chart %v: %w", c, err)
+		}
+
+		chartViolations, err := validateChartSchema(c.resolved.charter, values, "")
+		if err != nil {
+			return nil, fmt.Errorf("chart %v: %w", c, err)
+		}
+
+		sources := d.chartValueSources(c)
+		for _, violation := range chartViolations {
+			violation.Chart = c.String()
+			d.locateViolation(&violation, sources)
+			violations = append(violations, violation)
+		}
+	}
+
+	return violations, nil
+}
+
+// validateChartSchema validates values against the schema of a chart and, recursively, the values of its subcharts against
+// their schemas. prefix is the JSON pointer of values within the values of the top chart.
+func validateChartSchema(charter chart.Charter, values map[string]any, prefix string) ([]SchemaViolation, error) {
+	accessor, err := chart.NewAccessor(charter)
+	if err != nil {
+		return nil, err
+	}
+
+	var violations []SchemaViolation
+	if schema := accessor.Schema(); schema != nil {
+		schemaViolations, err := validateSchema(schema, values)
+		if err != nil {
+			return nil, fmt.Errorf("values.schema.json of %v: %w", accessor.Name(), err)
+		}
+		for _, violation := range schemaViolations {
+			violation.Pointer = prefix + violation.Pointer
+			violations = append(violations, violation)
+		}
+	}
+
+	for _, subchart := range accessor.Dependencies() {
+		sub, err := chart.NewAccessor(subchart)
+		if err != nil {
+			return nil, err
+		}
+
+		subValues, ok := values[sub.Name()].(map[string]any)
+		if !ok {
+			continue // Helm reports a wrong type of the subchart values when rendering
+		}
+
+		subViolations, err := validateChartSchema(subchart, subValues, prefix+"/"+sub.Name())
+		if err != nil {
+			return nil, err
+		}
+		violations = append(violations, subViolations...)
+	}
+
+	return violations, nil
+}
+
+// validateSchema validates values against a JSON schema and returns a violation for each failing keyword.
+// Only schemas within the chart and local files are loaded, validation never goes online.
+func validateSchema(schemaJSON []byte, values map[string]any) ([]SchemaViolation, error) {
+	schema, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	validator, err := compileSchema(schema, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return schemaViolations(validator, values)
+}
+
+// compileSchema compiles a decoded JSON schema. Schemas not declaring their draft with $schema are read as draft, or the
+// latest draft if draft is nil.
+func compileSchema(schema any, draft *jsonschema.Draft) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	if draft != nil {
+		compiler.DefaultDraft(draft)
+	}
+	if err := compiler.AddResource("file:///schema.json", schema); err != nil {
+		return nil, err
+	}
+
+	return compiler.Compile("file:///schema.json")
+}
+
+// schemaViolations validates value against a compiled schema and returns a violation, with pointer and message, for each
+// failing keyword.
+func schemaViolations(validator *jsonschema.Schema, value any) ([]SchemaViolation, error) {
+	// Round trip through JSON to get the value types the validator expects
+	valueJSON, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(valueJSON))
+	if err != nil {
+		return nil, err
+	}
+
+	err = validator.Validate(instance)
+	if err == nil {
+		return nil, nil
+	}
+	validationErr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return nil, err
+	}
+
+	var violations []SchemaViolation
+	var collect func(e *jsonschema.ValidationError)
+	collect = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) == 0 {
+			violations = append(violations, SchemaViolation{
+				Pointer: jsonPointer(e.InstanceLocation),
+				Message: e.ErrorKind.LocalizedString(schemaMessagePrinter),
+			})
+		}
+		for _, cause := range e.Causes {
+			collect(cause)
+		}
+	}
+	collect(validationErr)
+
+	slices.SortStableFunc(violations, func(a, b SchemaViolation) int { return strings.Compare(a.Pointer, b.Pointer) })
+
+	return violations, nil
+}
+
+// locateViolation sets where the offending value of a violation is set. If the value isn't set anywhere, as for a missing
+// required property, the closest parent value that is set is used.
+func (d *Document) locateViolation(violation *SchemaViolation, sources []*valueSource) {
+	for pointer := violation.Pointer; pointer != ""; pointer = pointer[:strings.LastIndex(pointer, "/")] {
+		candidates := d.valueCandidates(sources, pointer, 0)
+		if len(candidates) == 0 {
+			continue
+		}
+
+		winner := candidates[0]
+		for len(winner.RefChain) > 0 {
+			winner = winner.RefChain[0]
+		}
+		violation.Source = winner.Source
+		violation.File = winner.File
+		violation.Line = winner.Line
+
+		return
+	}
+}
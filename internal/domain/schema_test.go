@@ -0,0 +1,99 @@
+package domain
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestValidateSchema(t *testing.T) {
+	schema := []byte(`{
+  "type": "object",
+  "required": ["image"],
+  "properties": {
+    "replicaCount": {"type": "integer", "minimum": 1},
+    "ports": {"type": "array", "items": {"type": "integer"}}
+  }
+}`)
+	values := map[string]any{
+		"replicaCount": 0,
+		"ports":        []any{80, "http"},
+	}
+
+	violations, err := validateSchema(schema, values)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pointers := make(map[string]bool)
+	for _, violation := range violations {
+		pointers[violation.Pointer] = true
+	}
+	for _, expected := range []string{"", "/replicaCount", "/ports/1"} {
+		if !pointers[expected] {
+			t.Errorf("expected a violation at %q, got %v", expected, violations)
+		}
+	}
+	if len(violations) != 3 {
+		t.Errorf("expected 3 violations, got %v", violations)
+	}
+}
+
+func TestValidateValuesLocatesViolations(t *testing.T) {
+	files := map[string]string{
+		"charts/app/Chart.yaml":  "apiVersion: v2\nname: app\nversion: 1.0.0\n",
+		"charts/app/values.yaml": "replicas: 1\nport: 80\nimage:\n  tag: latest\n",
+		"charts/app/values.schema.json": `{
+  "type": "object",
+  "properties": {
+    "replicas": {"type": "integer", "minimum": 1},
+    "port": {"type": "integer", "maximum": 65535},
+    "image": {
+      "type": "object",
+      "required": ["repository"],
+      "properties": {"tag": {"type": "string"}}
+    }
+  }
+}`,
+		"prod.yaml": `includes:
+  - path: base.yaml
+charts:
+  - path: charts/app
+    values:
+      replicas: 0
+values:
+  image:
+    tag: 5
+`,
+		"base.yaml": `values:
+  port: 70000
+`,
+	}
+	doc := loadTestConfig(t, files, "prod.yaml", ValueOverrides{})
+
+	violations, err := doc.ValidateValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	found := make(map[string]string)
+	for _, violation := range violations {
+		found[violation.Pointer] = fmt.Sprintf("%v %v:%v", violation.Source, violation.File, violation.Line)
+	}
+	expected := map[string]string{
+		"/replicas":  "chart values prod.yaml:6",
+		"/image/tag": "global values prod.yaml:9",
+		"/image":     "global values prod.yaml:8", // Missing required repository
+		"/port":      "global values base.yaml:2",
+	}
+	if !reflect.DeepEqual(found, expected) {
+		t.Errorf("expected violations located at %v, got %v", expected, found)
+	}
+
+	// A value that isn't set anywhere is located at the closest parent that is set
+	violation := SchemaViolation{Pointer: "/image/repository/name"}
+	doc.locateViolation(&violation, doc.chartValueSources(doc.Charts[0]))
+	if location := fmt.Sprintf("%v %v:%v", violation.Source, violation.File, violation.Line); location != "global values prod.yaml:8" {
+		t.Errorf("expected /image/repository/name located at global values prod.yaml:8, got %v", location)
+	}
+}
@@ -0,0 +1,152 @@
+package domain
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+)
+
+// setSelector selects labels or annotations.
+type setSelector interface {
+	Matches(labels.Labels) bool
+}
+
+// matchSelector matches a set of labels or annotations against a selector parsed by parse. An empty selector matches any set.
+func matchSelector(selector string, parse func(string) (setSelector, error), set map[string]any) (bool, error) {
+	if selector == "" {
+		return true, nil
+	}
+
+	parsed, err := parse(selector)
+	if err != nil {
+		return false, err
+	}
+
+	values := make(labels.Set, len(set))
+	for key, value := range set {
+		values[key] = fmt.Sprint(value)
+	}
+
+	return parsed.Matches(values), nil
+}
+
+// parseLabelSelector parses a Kubernetes label selector, including set-based requirements like env in (dev,test) and !canary.
+func parseLabelSelector(selector string) (setSelector, error) {
+	return labels.Parse(selector)
+}
+
+// annotationSelector is a selector with the syntax of a label selector that allows any value, as annotation values can be
+// anything, like URLs or descriptions. Only commas and parentheses can't be used in values.
+type annotationSelector []annotationRequirement
+
+type annotationRequirement struct {
+	key      string
+	operator selection.Operator
+	values   []string
+}
+
+var annotationSetRequirement = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// parseAnnotationSelector parses a selector with label selector syntax without validating the values, e.g.
+// example.com/docs=https://example.com/app,!deprecated.
+func parseAnnotationSelector(selector string) (setSelector, error) {
+	var result annotationSelector
+	for _, requirement := range splitSelector(selector) {
+		requirement = strings.TrimSpace(requirement)
+
+		var r annotationRequirement
+		if match := annotationSetRequirement.FindStringSubmatch(requirement); match != nil {
+			r = annotationRequirement{key: match[1], operator: selection.In}
+			if match[2] == "notin" {
+				r.operator = selection.NotIn
+			}
+			for value := range strings.SplitSeq(match[3], ",") {
+				r.values = append(r.values, strings.TrimSpace(value))
+			}
+		} else if key, value, ok := strings.Cut(requirement, "="); ok {
+			r = annotationRequirement{key: strings.TrimSpace(key), operator: selection.Equals}
+			if strings.HasSuffix(r.key, "!") {
+				r.key, r.operator = strings.TrimSpace(strings.TrimSuffix(r.key, "!")), selection.NotEquals
+			} else if strings.HasPrefix(value, "=") {
+				value = value[1:]
+			}
+			r.values = []string{strings.TrimSpace(value)}
+		} else if key, ok := strings.CutPrefix(requirement, "!"); ok {
+			r = annotationRequirement{key: strings.TrimSpace(key), operator: selection.DoesNotExist}
+		} else {
+			r = annotationRequirement{key: requirement, operator: selection.Exists}
+		}
+
+		if r.key == "" || strings.ContainsAny(r.key, " \t()!") {
+			return nil, fmt.Errorf("invalid requirement %q in selector %q", requirement, selector)
+		}
+		result = append(result, r)
+	}
+
+	if len(result) == 0 {
+		return nil, errors.New("empty selector")
+	}
+
+	return result, nil
+}
+
+// splitSelector splits a selector into its requirements at the commas outside of parentheses.
+func splitSelector(selector string) []string {
+	var requirements []string
+	depth, start := 0, 0
+	for i, c := range selector {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				requirements = append(requirements, selector[start:i])
+				start = i + 1
+			}
+		}
+	}
+
+	return append(requirements, selector[start:])
+}
+
+func (s annotationSelector) Matches(annotations labels.Labels) bool {
+	for _, r := range s {
+		value, exists := annotations.Lookup(r.key)
+
+		switch r.operator {
+		case selection.Exists:
+			if !exists {
+				return false
+			}
+		case selection.DoesNotExist:
+			if exists {
+				return false
+			}
+		case selection.Equals:
+			if !exists || value != r.values[0] {
+				return false
+			}
+		case selection.NotEquals:
+			if exists && value == r.values[0] {
+				return false
+			}
+		case selection.In:
+			if !exists || !slices.Contains(r.values, value) {
+				return false
+			}
+		case selection.NotIn:
+			if exists && slices.Contains(r.values, value) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,31 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/getsops/sops/v3/decrypt"
+	"github.com/goccy/go-yaml"
+)
+
+// decryptSOPSFile decrypts a YAML or JSON file encrypted by SOPS and returns its content. Keys are found the same way the
+// sops command finds them, e.g. age keys in $SOPS_AGE_KEY_FILE. The integrity of the file is verified against the MAC of
+// the file.
+func decryptSOPSFile(path string) (map[string]any, error) {
+	format := "yaml"
+	if strings.HasSuffix(path, ".json") {
+		format = "json"
+	}
+
+	content, err := decrypt.File(path, format)
+	if err != nil {
+		return nil, fmt.Errorf("error decrypting %v: %w", path, err)
+	}
+
+	var values map[string]any
+	if err := yaml.Unmarshal(content, &values); err != nil {
+		return nil, fmt.Errorf("error decoding decrypted %v:\n%w", path, err)
+	}
+
+	return values, nil
+}
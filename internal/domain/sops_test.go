@@ -0,0 +1,148 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+)
+
+// The files in testdata/sops are encrypted by sops 3.10.2 with the age key in testdata/sops/key.txt. encrypted-regex.enc.yaml
+// is encrypted with --encrypted-regex '^password$' and unencrypted-regex.enc.yaml with --unencrypted-regex '^public'
+// --mac-only-encrypted. Both have comments.
+
+// useAgeKeyFile makes the age keys in a key file the only keys available for the duration of a test.
+func useAgeKeyFile(t *testing.T, keyFile string) {
+	t.Helper()
+
+	t.Setenv("SOPS_AGE_KEY_FILE", keyFile)
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	for _, env := range []string{"SOPS_AGE_KEY", "SOPS_AGE_KEY_CMD", "SOPS_AGE_SSH_PRIVATE_KEY_FILE"} {
+		if value, ok := os.LookupEnv(env); ok {
+			os.Unsetenv(env)
+			t.Cleanup(func() { os.Setenv(env, value) })
+		}
+	}
+}
+
+func TestDecryptSOPSFile(t *testing.T) {
+	useAgeKeyFile(t, "testdata/sops/key.txt")
+
+	values, err := decryptSOPSFile("testdata/sops/secrets.enc.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"database": map[string]any{
+			"user":             "admin",
+			"password":         "s3cr3t",
+			"port":             uint64(5432),
+			"ratio":            0.5,
+			"enabled":          true,
+			"hosts":            []any{"a.example.com", "b.example.com"},
+			"empty":            "",
+			"note_unencrypted": "visible",
+		},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+
+	values, err = decryptSOPSFile("testdata/sops/secrets.enc.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if values["token"] != "abc" {
+		t.Errorf("expected token abc, got %v", values["token"])
+	}
+}
+
+func TestDecryptSOPSFilePartiallyEncrypted(t *testing.T) {
+	useAgeKeyFile(t, "testdata/sops/key.txt")
+
+	values, err := decryptSOPSFile("testdata/sops/encrypted-regex.enc.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]any{"database": map[string]any{"host": "db.example.com", "password": "s3cr3t", "port": uint64(5432)}}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+
+	values, err = decryptSOPSFile("testdata/sops/unencrypted-regex.enc.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = map[string]any{
+		"public_url": "https://example.com/app",
+		"token":      "abc",
+		"nested":     map[string]any{"secret_key": "xyz", "public_name": "app"},
+	}
+	if !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+
+	// Values left in clear text by encrypted_regex are still covered by the MAC
+	content, err := os.ReadFile("testdata/sops/encrypted-regex.enc.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := filepath.Join(t.TempDir(), "encrypted-regex.enc.yaml")
+	if err := os.WriteFile(tampered, []byte(strings.Replace(string(content), "port: 5432", "port: 5433", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decryptSOPSFile(tampered); err == nil || !strings.Contains(err.Error(), "integrity") {
+		t.Errorf("expected MAC mismatch, got %v", err)
+	}
+}
+
+func TestDecryptSOPSFileTampered(t *testing.T) {
+	useAgeKeyFile(t, "testdata/sops/key.txt")
+
+	content, err := os.ReadFile("testdata/sops/secrets.enc.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := filepath.Join(t.TempDir(), "secrets.enc.yaml")
+	if err := os.WriteFile(tampered, []byte(strings.Replace(string(content), "note_unencrypted: visible", "note_unencrypted: changed", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := decryptSOPSFile(tampered); err == nil || !strings.Contains(err.Error(), "integrity") {
+		t.Errorf("expected MAC mismatch, got %v", err)
+	}
+}
+
+func TestDecryptSOPSFileWrongKey(t *testing.T) {
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyFile := filepath.Join(t.TempDir(), "key.txt")
+	if err := os.WriteFile(keyFile, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	useAgeKeyFile(t, keyFile)
+
+	if _, err := decryptSOPSFile("testdata/sops/secrets.enc.yaml"); err == nil || !strings.Contains(err.Error(), "data key") {
+		t.Errorf("expected decryption with the wrong key to fail, got %v", err)
+	}
+}
+
+func TestResolveSOPSDirective(t *testing.T) {
+	useAgeKeyFile(t, "testdata/sops/key.txt")
+
+	values := map[string]any{
+		"password": map[string]any{"$sops": "sops/secrets.enc.yaml#/database/password"},
+	}
+	if err := resolveValueFileAndExternalRefs(values, "testdata"); err != nil {
+		t.Fatal(err)
+	}
+	if values["password"] != "s3cr3t" {
+		t.Errorf("expected password s3cr3t, got %v", values["password"])
+	}
+}
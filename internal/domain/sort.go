@@ -0,0 +1,66 @@
+package domain
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+	"strings"
+
+	releaseutil "helm.sh/helm/v4/pkg/release/v1/util"
+)
+
+// Sort orders
+const (
+	SortNone         = "none"         // Resources are kept in the order they are rendered. This is the default.
+	SortInstallOrder = "installOrder" // Resources are sorted by kind in the order Helm installs them, then by namespace and name.
+)
+
+func (t *Target) sortOrder() (string, error) {
+	switch t.Sort {
+	case "":
+		return SortNone, nil
+	case SortNone, SortInstallOrder:
+		return t.Sort, nil
+	default:
+		return "", fmt.Errorf("unknown target sort %q, must be one of %v or %v", t.Sort, SortNone, SortInstallOrder)
+	}
+}
+
+// sortManifests sorts the resources of a multi document manifest in Helm install order.
+// Kinds unknown to Helm go last, sorted alphabetically. Resources of the same kind are sorted by namespace,
+// name and apiVersion. Documents without content are dropped.
+func sortManifests(manifests string) (string, error) {
+	docs, err := parseResourceDocuments(manifests)
+	if err != nil {
+		return "", err
+	}
+
+	installOrder := make(map[string]int, len(releaseutil.InstallOrder))
+	for i, kind := range releaseutil.InstallOrder {
+		installOrder[kind] = i
+	}
+	kindOrder := func(kind string) int {
+		if i, ok := installOrder[kind]; ok {
+			return i
+		}
+		return len(installOrder)
+	}
+
+	slices.SortStableFunc(docs, func(a, b resourceDocument) int {
+		return cmp.Or(
+			cmp.Compare(kindOrder(a.key.Kind), kindOrder(b.key.Kind)),
+			strings.Compare(a.key.Kind, b.key.Kind),
+			strings.Compare(a.key.Namespace, b.key.Namespace),
+			strings.Compare(a.key.Name, b.key.Name),
+			strings.Compare(a.key.APIVersion, b.key.APIVersion),
+		)
+	})
+
+	var result strings.Builder
+	for _, doc := range docs {
+		result.WriteString("---\n")
+		result.WriteString(doc.content)
+	}
+
+	return result.String(), nil
+}
@@ -0,0 +1,143 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	jsonpatch "github.com/evanphx/json-patch/v5"
+	"github.com/goccy/go-yaml"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/strategicpatch"
+	"k8s.io/client-go/kubernetes/scheme"
+	sigsyaml "sigs.k8s.io/yaml"
+)
+
+// applyStrategicMerge merges a partial object into a YAML document with Kubernetes strategic merge semantics, e.g. merging
+// containers by name. Kinds not built into Kubernetes, like custom resources, have no merge strategy and get a JSON merge
+// patch (RFC 7386) instead.
+func applyStrategicMerge(doc []byte, manifest map[string]any, patch map[string]any) ([]byte, error) {
+	if manifest == nil {
+		return doc, nil // Nothing to merge into
+	}
+
+	docJSON, err := sigsyaml.YAMLToJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	patchJSON, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	key := resourceKeyOf(manifest)
+	gvk := schema.FromAPIVersionAndKind(key.APIVersion, key.Kind)
+
+	dataStruct, err := scheme.Scheme.New(gvk)
+	if err != nil {
+		return applyMergePatch(doc, manifest, patch)
+	}
+
+	mergedJSON, err := strategicpatch.StrategicMergePatch(docJSON, patchJSON, dataStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalLike(mergedJSON, doc)
+}
+
+// applyMergePatch applies a JSON merge patch (RFC 7386) to a YAML document. Fields set to null in the patch are deleted and
+// lists are replaced as a whole.
+func applyMergePatch(doc []byte, manifest map[string]any, patch map[string]any) ([]byte, error) {
+	if manifest == nil {
+		return doc, nil // Nothing to merge into
+	}
+
+	docJSON, err := sigsyaml.YAMLToJSON(doc)
+	if err != nil {
+		return nil, err
+	}
+	patchJSON, err := json.Marshal(patch)
+	if err != nil {
+		return nil, err
+	}
+
+	mergedJSON, err := jsonpatch.MergePatch(docJSON, patchJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return marshalLike(mergedJSON, doc)
+}
+
+// marshalLike formats a JSON document as YAML, keeping the order of keys and the leading comments, like # Source, of the
+// original YAML document it was derived from. Keys not in the original go last.
+func marshalLike(docJSON []byte, original []byte) ([]byte, error) {
+	var doc, originalDoc any
+	if err := yaml.UnmarshalWithOptions(docJSON, &doc, yaml.UseOrderedMap()); err != nil {
+		return nil, err
+	}
+	if err := yaml.UnmarshalWithOptions(original, &originalDoc, yaml.UseOrderedMap()); err != nil {
+		return nil, err
+	}
+
+	out, err := yaml.MarshalWithOptions(orderLike(doc, originalDoc), yaml.IndentSequence(true))
+	if err != nil {
+		return nil, err
+	}
+
+	var result bytes.Buffer
+	for line := range strings.Lines(string(original)) {
+		if !strings.HasPrefix(line, "#") && strings.TrimSpace(line) != "" {
+			break
+		}
+		result.WriteString(line)
+	}
+	result.Write(out)
+
+	return result.Bytes(), nil
+}
+
+// orderLike orders the keys of the maps in node like the keys of the corresponding maps in original.
+// Sequence items correspond by index.
+func orderLike(node any, original any) any {
+	switch node := node.(type) {
+	case yaml.MapSlice:
+		originalMap, _ := original.(yaml.MapSlice)
+
+		values := make(map[any]any, len(node))
+		for _, item := range node {
+			values[item.Key] = item.Value
+		}
+
+		var result yaml.MapSlice
+		for _, item := range originalMap {
+			if value, ok := values[item.Key]; ok {
+				result = append(result, yaml.MapItem{Key: item.Key, Value: orderLike(value, item.Value)})
+				delete(values, item.Key)
+			}
+		}
+		for _, item := range node {
+			if _, ok := values[item.Key]; ok {
+				result = append(result, yaml.MapItem{Key: item.Key, Value: orderLike(item.Value, nil)})
+			}
+		}
+
+		return result
+	case []any:
+		originalSlice, _ := original.([]any)
+
+		result := make([]any, len(node))
+		for i, item := range node {
+			var originalItem any
+			if i < len(originalSlice) {
+				originalItem = originalSlice[i]
+			}
+			result[i] = orderLike(item, originalItem)
+		}
+
+		return result
+	default:
+		return node
+	}
+}
@@ -1,7 +1,12 @@
 package domain
 
 import (
+	"bytes"
+	"fmt"
 	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
 
 	"os"
 	stdpath "path"
@@ -10,40 +15,297 @@ import (
 	releasev1 "helm.sh/helm/v4/pkg/release/v1"
 )
 
+// Target layouts
+const (
+	LayoutSingleFile  = "singleFile"  // All resources of a chart are written to manifest.yaml. This is the default.
+	LayoutPerResource = "perResource" // Each resource is written to a file of its own.
+)
+
+// DefaultFileName is the naming template used for the perResource layout if none is set.
+const DefaultFileName = "{{kind}}-{{name}}.yaml"
+
 type Target struct {
-	Path string `yaml:"path"`
+	Path          string `yaml:"path"`
+	Layout        string `yaml:"layout,omitempty"`
+	FileName      string `yaml:"fileName,omitempty"`      // Naming template for the perResource layout
+	NamespaceDirs bool   `yaml:"namespaceDirs,omitempty"` // Write resources of the perResource layout to a sub directory per namespace
+	Sort          string `yaml:"sort,omitempty"`
+	Duplicates    string `yaml:"duplicates,omitempty"` // What to do with resources rendered more than once
 
 	renderedReleases []RenderedRelease
 }
 
 type RenderedRelease struct {
-	Release   *releasev1.Release
-	TargetDir string
+	Release       *releasev1.Release
+	TargetDir     string
+	HooksManifest string // Hooks to be written to a separate file
+	CRDsDir       string
+	CRDsManifest  string // CRDs to be written to CRDsDir
+
+	chart *Chart // The chart the release was rendered from
+}
+
+// RenderedFile is the content a Target produces for a single file.
+type RenderedFile struct {
+	Path    string
+	Content string
 }
 
 // fileCreated is a map that tracks whether a file with a given name has been created.
 var fileCreated = make(map[string]bool)
 
-// write writes all rendered releases associated with the Target to the specified base directory.
-func (t *Target) write(baseDir string) error {
+// fileOwner is the config and target layout a file is written with.
+type fileOwner struct {
+	config string
+	layout string
+}
+
+// fileOwners holds the owner of each file written by this process, keyed by absolute path.
+var fileOwners = make(map[string]fileOwner)
+
+// Files returns the files produced by the rendered releases of the Target, in render order.
+// In the singleFile layout releases sharing the same TargetDir are concatenated into a single file.
+// In the singleFile layout the resources of each file are sorted if a sort order is set.
+// In the perResource layout it is an error if two resources are given the same file name.
+func (t *Target) Files(baseDir string) ([]RenderedFile, error) {
 	dir := stdpath.Join(baseDir, t.Path)
 
+	layout, err := t.layout()
+	if err != nil {
+		return nil, err
+	}
+
+	sortOrder, err := t.sortOrder()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []RenderedFile
+	index := make(map[string]int)
+	add := func(fileName string, content string) {
+		if i, ok := index[fileName]; ok {
+			files[i].Content += content
+			return
+		}
+
+		index[fileName] = len(files)
+		files = append(files, RenderedFile{Path: fileName, Content: content})
+	}
+
+	if layout == LayoutPerResource {
+		fileName := t.FileName
+		if fileName == "" {
+			fileName = DefaultFileName
+		}
+		namer, err := newResourceFileNamer(fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		owners := make(map[string]string)
+		addResources := func(release RenderedRelease, resourceDir string, manifests string) error {
+			docs, err := parseResourceDocuments(manifests)
+			if err != nil {
+				return fmt.Errorf("error parsing manifests of chart %v:\n%w", release.TargetDir, err)
+			}
+
+			for _, doc := range docs {
+				name, err := namer.fileName(doc.key)
+				if err != nil {
+					return err
+				}
+
+				fileDir := resourceDir
+				if t.NamespaceDirs && doc.key.Namespace != "" {
+					fileDir = stdpath.Join(fileDir, sanitizeFileName(doc.key.Namespace))
+				}
+				path := stdpath.Join(fileDir, name)
+
+				owner := fmt.Sprintf("%v of chart %v", doc.key, release.Release.Chart.Name())
+				if previous, ok := owners[path]; ok {
+					return fmt.Errorf("resources %v and %v are both written to %v, change the fileName template of the target or the targetDir of the charts", previous, owner, path)
+				}
+				owners[path] = owner
+
+				add(path, "---\n"+doc.content)
+			}
+
+			return nil
+		}
+
+		for _, release := range t.renderedReleases {
+			if err := addResources(release, stdpath.Join(dir, release.TargetDir), release.Release.Manifest); err != nil {
+				return nil, err
+			}
+			if err := addResources(release, stdpath.Join(dir, release.TargetDir, "hooks"), release.HooksManifest); err != nil {
+				return nil, err
+			}
+			if err := addResources(release, stdpath.Join(dir, release.CRDsDir), release.CRDsManifest); err != nil {
+				return nil, err
+			}
+		}
+
+		return files, nil
+	}
+
 	for _, release := range t.renderedReleases {
-		err := writeRelease(dir, release)
+		add(stdpath.Join(dir, release.TargetDir, "manifest.yaml"), release.Release.Manifest)
+
+		if release.HooksManifest != "" {
+			add(stdpath.Join(dir, release.TargetDir, "hooks.yaml"), release.HooksManifest)
+		}
 
+		if release.CRDsManifest != "" {
+			add(stdpath.Join(dir, release.CRDsDir, "manifest.yaml"), release.CRDsManifest)
+		}
+	}
+
+	if sortOrder == SortInstallOrder {
+		for i := range files {
+			files[i].Content, err = sortManifests(files[i].Content)
+			if err != nil {
+				return nil, fmt.Errorf("error sorting %v:\n%w", files[i].Path, err)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+func (t *Target) layout() (string, error) {
+	switch t.Layout {
+	case "":
+		return LayoutSingleFile, nil
+	case LayoutSingleFile, LayoutPerResource:
+		return t.Layout, nil
+	default:
+		return "", fmt.Errorf("unknown target layout %q, must be one of %v or %v", t.Layout, LayoutSingleFile, LayoutPerResource)
+	}
+}
+
+// resourceFileNamer names the files of the perResource layout.
+// The naming template is a Go template where the fields of the resource are available as functions, e.g. {{kind}}-{{name}}.yaml.
+type resourceFileNamer struct {
+	template *template.Template
+	key      ResourceKey // Resource currently being named
+}
+
+func newResourceFileNamer(fileName string) (*resourceFileNamer, error) {
+	n := &resourceFileNamer{}
+
+	group := func() string {
+		group, _, found := strings.Cut(n.key.APIVersion, "/")
+		if !found {
+			return "core"
+		}
+		return sanitizeFileName(group)
+	}
+	version := func() string {
+		_, version, found := strings.Cut(n.key.APIVersion, "/")
+		if !found {
+			version = n.key.APIVersion
+		}
+		return sanitizeFileName(version)
+	}
+
+	tmpl, err := template.New("fileName").Funcs(template.FuncMap{
+		"apiVersion": func() string { return sanitizeFileName(n.key.APIVersion) },
+		"group":      group,
+		"version":    version,
+		"kind":       func() string { return sanitizeFileName(n.key.Kind) },
+		"name":       func() string { return sanitizeFileName(n.key.Name) },
+		"namespace":  func() string { return sanitizeFileName(n.key.Namespace) },
+		"lower":      strings.ToLower,
+	}).Parse(fileName)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing target fileName template %q:\n%w", fileName, err)
+	}
+	n.template = tmpl
+
+	return n, nil
+}
+
+func (n *resourceFileNamer) fileName(key ResourceKey) (string, error) {
+	n.key = key
+
+	var name bytes.Buffer
+	if err := n.template.Execute(&name, nil); err != nil {
+		return "", fmt.Errorf("error naming file for %v:\n%w", key, err)
+	}
+	if name.Len() == 0 {
+		return "", fmt.Errorf("target fileName template gives an empty file name for %v", key)
+	}
+
+	return name.String(), nil
+}
+
+var unsafeFileNameChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// sanitizeFileName replaces characters that are unsafe in file names, like the colon in system:auth-delegator, with underscores.
+func sanitizeFileName(name string) string {
+	return unsafeFileNameChars.ReplaceAllString(name, "_")
+}
+
+// write writes all rendered releases associated with the Target to the specified base directory.
+// The files are tracked in the index of the target directory as written by config.
+func (t *Target) write(baseDir string, config string, prune bool) error {
+	files, err := t.Files(baseDir)
+	if err != nil {
+		return err
+	}
+
+	if err := t.track(baseDir, config, files, prune); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if err := writeFile(file); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// track records the files of the Target as written by config, in the index of the target directory and as owned by config.
+// Files of the singleFile layout written by several configs are concatenated, any other file written by more than one
+// config is an error. If prune is set, files outside of the target directory are an error too, see trackWrittenFile.
+func (t *Target) track(baseDir string, config string, files []RenderedFile, prune bool) error {
+	layout, err := t.layout()
+	if err != nil {
+		return err
+	}
+
+	targetDir := stdpath.Join(baseDir, t.Path)
+	if err := trackTarget(targetDir, config); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		absFileName, err := filepath.Abs(file.Path)
 		if err != nil {
 			return err
 		}
+
+		owner := fileOwner{config: config, layout: layout}
+		if previous, ok := fileOwners[absFileName]; ok && (previous.layout != LayoutSingleFile || layout != LayoutSingleFile) {
+			return fmt.Errorf("%v is written by both %v and %v, only files of the %v layout can be shared, change the fileName template of the target or the targetDir of the charts", file.Path, previous.config, config, LayoutSingleFile)
+		}
+		fileOwners[absFileName] = owner
+
+		if err := trackWrittenFile(targetDir, config, file.Path, prune); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
-// writeRelease writes the manifest of the given Helm release to a YAML file in the specified directory.
+// writeFile writes a rendered file to disk.
 // If the file already exists (tracked by the fileCreated map), it appends to the file; otherwise, it creates a new file.
-// The function ensures the target directory exists, handles file creation and opening, and writes the release manifest content.
-func writeRelease(dir string, release RenderedRelease) error {
-	fileName := stdpath.Join(dir, release.TargetDir, "manifest.yaml")
+// The function ensures the target directory exists, handles file creation and opening, and writes the content.
+func writeFile(renderedFile RenderedFile) error {
+	fileName := renderedFile.Path
 
 	logger.Verbosef(2, "Writing manifest %v", fileName)
 	absFileName, err := filepath.Abs(fileName)
@@ -72,7 +334,7 @@ func writeRelease(dir string, release RenderedRelease) error {
 	}
 	defer file.Close()
 
-	_, err = file.Write([]byte(release.Release.Manifest))
+	_, err = file.Write([]byte(renderedFile.Content))
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,194 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	chartv2 "helm.sh/helm/v4/pkg/chart/v2"
+	releasev1 "helm.sh/helm/v4/pkg/release/v1"
+)
+
+func renderedRelease(targetDir string, manifest string) RenderedRelease {
+	return RenderedRelease{
+		Release:   &releasev1.Release{Manifest: manifest, Chart: &chartv2.Chart{Metadata: &chartv2.Metadata{Name: targetDir}}},
+		TargetDir: targetDir,
+	}
+}
+
+func TestTargetFilesPerResource(t *testing.T) {
+	manifest := `---
+# Source: app/templates/service.yaml
+apiVersion: v1
+kind: Service
+metadata:
+  name: app
+  namespace: prod
+---
+# Source: app/templates/clusterrole.yaml
+apiVersion: rbac.authorization.k8s.io/v1
+kind: ClusterRole
+metadata:
+  name: system:app
+`
+	target := Target{Path: "prod", Layout: LayoutPerResource, FileName: "{{lower kind}}-{{name}}.yaml", NamespaceDirs: true}
+	target.renderedReleases = []RenderedRelease{renderedRelease("app", manifest)}
+
+	files, err := target.Files("out")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Path)
+	}
+	expected := []string{"out/prod/app/prod/service-app.yaml", "out/prod/app/clusterrole-system_app.yaml"}
+	if strings.Join(paths, ",") != strings.Join(expected, ",") {
+		t.Fatalf("expected files %v, got %v", expected, paths)
+	}
+	if !strings.HasPrefix(files[0].Content, "---\n# Source: app/templates/service.yaml\n") {
+		t.Errorf("unexpected content %q", files[0].Content)
+	}
+}
+
+func TestTargetFilesPerResourceCollision(t *testing.T) {
+	manifest := "---\napiVersion: v1\nkind: Service\nmetadata:\n  name: app\n"
+
+	target := Target{Path: "prod", Layout: LayoutPerResource}
+	target.renderedReleases = []RenderedRelease{renderedRelease("app", manifest), renderedRelease("app", manifest)}
+
+	if _, err := target.Files("out"); err == nil || !strings.Contains(err.Error(), "out/prod/app/Service-app.yaml") {
+		t.Fatalf("expected collision on out/prod/app/Service-app.yaml, got %v", err)
+	}
+}
+
+func TestTargetFilesInstallOrder(t *testing.T) {
+	manifest := `---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: b
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: a
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: a
+---
+apiVersion: v1
+kind: ServiceAccount
+metadata:
+  name: z
+`
+	target := Target{Path: "prod", Sort: SortInstallOrder}
+	target.renderedReleases = []RenderedRelease{renderedRelease("app", manifest)}
+
+	files, err := target.Files("out")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	docs, err := parseResourceDocuments(files[0].Content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var order []string
+	for _, doc := range docs {
+		order = append(order, doc.key.Kind+"/"+doc.key.Name)
+	}
+	expected := []string{"ServiceAccount/z", "Deployment/a", "Deployment/b", "Widget/a"}
+	if strings.Join(order, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected order %v, got %v", expected, order)
+	}
+}
+
+func TestTargetTrackSharedFiles(t *testing.T) {
+	fileOwners = make(map[string]fileOwner)
+	writtenFiles = make(map[string]*targetFiles)
+	t.Cleanup(func() {
+		fileOwners = make(map[string]fileOwner)
+		writtenFiles = make(map[string]*targetFiles)
+	})
+
+	manifest := "---\napiVersion: v1\nkind: Service\nmetadata:\n  name: app\n"
+	track := func(config string, layout string) error {
+		target := Target{Path: "prod", Layout: layout}
+		target.renderedReleases = []RenderedRelease{renderedRelease("app", manifest)}
+
+		files, err := target.Files("out")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return target.track("out", config, files, false)
+	}
+
+	// Files of the singleFile layout are concatenated
+	if err := track("a.yaml", LayoutSingleFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := track("b.yaml", LayoutSingleFile); err != nil {
+		t.Errorf("expected manifest.yaml to be shared, got %v", err)
+	}
+
+	// A file of the perResource layout holds one resource
+	if err := track("a.yaml", LayoutPerResource); err != nil {
+		t.Fatal(err)
+	}
+	if err := track("b.yaml", LayoutPerResource); err == nil || !strings.Contains(err.Error(), "out/prod/app/Service-app.yaml is written by both a.yaml and b.yaml") {
+		t.Errorf("expected collision on out/prod/app/Service-app.yaml, got %v", err)
+	}
+}
+
+func TestTargetWriteOutsideTargetDir(t *testing.T) {
+	fileOwners = make(map[string]fileOwner)
+	writtenFiles = make(map[string]*targetFiles)
+	unindexedFiles = nil
+	t.Cleanup(func() {
+		fileOwners = make(map[string]fileOwner)
+		writtenFiles = make(map[string]*targetFiles)
+		unindexedFiles = nil
+	})
+
+	dir := t.TempDir()
+	baseDir := filepath.ToSlash(dir)
+	target := Target{Path: "prod"}
+	target.renderedReleases = []RenderedRelease{
+		renderedRelease("app", "---\napiVersion: v1\nkind: Service\nmetadata:\n  name: app\n"),
+		renderedRelease("../shared", "---\napiVersion: v1\nkind: ConfigMap\nmetadata:\n  name: shared\n"),
+	}
+
+	// Without pruning a chart targetDir outside of the target still renders, the file is left out of the index
+	if err := target.write(baseDir, "prod.yaml", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "shared", "manifest.yaml")); err != nil {
+		t.Errorf("expected shared/manifest.yaml to be written, got %v", err)
+	}
+	if expected := []string{baseDir + "/shared/manifest.yaml"}; !reflect.DeepEqual(UnindexedFiles(), expected) {
+		t.Errorf("expected unindexed files %v, got %v", expected, UnindexedFiles())
+	}
+	if _, err := WriteTargetIndexes(false); err != nil {
+		t.Fatal(err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "prod", IndexFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := indexHeader + "[prod.yaml]\napp/manifest.yaml\n"; string(index) != expected {
+		t.Errorf("expected index\n%v\ngot\n%v", expected, string(index))
+	}
+
+	// When pruning it is an error, as the index can't tell if the file is stale
+	fileOwners = make(map[string]fileOwner)
+	if err := target.write(baseDir, "prod.yaml", true); err == nil || !strings.Contains(err.Error(), "outside of the target directory") {
+		t.Errorf("expected error for a file outside of the target directory, got %v", err)
+	}
+}
@@ -0,0 +1,270 @@
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/santhosh-tekuri/jsonschema/v6"
+	"helm.sh/helm/v4/pkg/chart/common"
+)
+
+// ManifestViolation is a rendered resource that doesn't validate against the schema of its kind.
+type ManifestViolation struct {
+	TargetDir string
+	Resource  ResourceKey
+	Pointer   string // JSON pointer to the offending field, empty for the resource itself
+	Message   string
+}
+
+func (v ManifestViolation) String() string {
+	pointer := v.Pointer
+	if pointer == "" {
+		pointer = "/"
+	}
+
+	return fmt.Sprintf("%v: %v %v: %v", v.TargetDir, v.Resource, pointer, v.Message)
+}
+
+// manifestSchemas finds and caches the schemas rendered resources are validated against.
+type manifestSchemas struct {
+	dirs     []string                      // Directories with schemas of built-in kinds, in order of preference
+	crds     map[string]any                // Schemas of custom resources by group/version/kind, from CRDs in the render
+	compiled map[string]*jsonschema.Schema // Compiled schemas by group/version/kind
+}
+
+// ValidateManifests validates the rendered resources of the document target against Kubernetes JSON schemas, without
+// contacting a cluster. Schemas of built-in kinds are read from schemaDir, for the kube version of the capabilities. Custom
+// resources are validated against the schemas of the CRDs rendered in the target. RenderTarget must be called first.
+//
+// schemaDir uses the layout of the kubernetes-json-schema project, e.g. v1.33.0-standalone-strict/deployment-apps-v1.json.
+// Schemas directly in schemaDir are used if there is no directory for the kube version. Without schemaDir only custom
+// resources are validated.
+func (d *Document) ValidateManifests(schemaDir string) ([]ManifestViolation, error) {
+	if d.Target == nil {
+		return nil, nil
+	}
+
+	schemas, err := newManifestSchemas(schemaDir)
+	if err != nil {
+		return nil, err
+	}
+
+	type renderedDocument struct {
+		targetDir string
+		resourceDocument
+	}
+
+	var docs []renderedDocument
+	for _, release := range d.Target.renderedReleases {
+		for _, manifest := range []string{release.CRDsManifest, release.Release.Manifest, release.HooksManifest} {
+			parsed, err := parseResourceDocuments(manifest)
+			if err != nil {
+				return nil, fmt.Errorf("error parsing manifests of %v: %w", release.TargetDir, err)
+			}
+			for _, doc := range parsed {
+				docs = append(docs, renderedDocument{targetDir: release.TargetDir, resourceDocument: doc})
+			}
+		}
+	}
+
+	for _, doc := range docs {
+		if err := schemas.addCRD(doc.manifest); err != nil {
+			return nil, fmt.Errorf("%v: %v: %w", doc.targetDir, doc.key, err)
+		}
+	}
+
+	var violations []ManifestViolation
+	for _, doc := range docs {
+		violation := ManifestViolation{TargetDir: doc.targetDir, Resource: doc.key}
+
+		schema, err := schemas.schema(doc.key)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v: %w", doc.targetDir, doc.key, err)
+		}
+		if schema == nil {
+			if len(schemas.dirs) > 0 && isBuiltInGroup(apiGroup(doc.key.APIVersion)) {
+				violation.Message = fmt.Sprintf("no schema found for %v %v", doc.key.APIVersion, doc.key.Kind)
+				violations = append(violations, violation)
+			}
+			continue
+		}
+
+		docViolations, err := schemaViolations(schema, doc.manifest)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v: %w", doc.targetDir, doc.key, err)
+		}
+		for _, docViolation := range docViolations {
+			violation.Pointer = docViolation.Pointer
+			violation.Message = docViolation.Message
+			violations = append(violations, violation)
+		}
+	}
+
+	return violations, nil
+}
+
+func newManifestSchemas(schemaDir string) (*manifestSchemas, error) {
+	schemas := &manifestSchemas{crds: make(map[string]any), compiled: make(map[string]*jsonschema.Schema)}
+	if schemaDir == "" {
+		return schemas, nil
+	}
+
+	kubeVersion, err := GlobalCapabilities.KubeVersion.helmKubeVersion()
+	if err != nil {
+		return nil, err
+	}
+	if kubeVersion == nil {
+		kubeVersion = &common.DefaultCapabilities.KubeVersion
+	}
+
+	version := "v" + strings.TrimPrefix(kubeVersion.Version, "v")
+	for _, dir := range []string{version + "-standalone-strict", version + "-standalone"} {
+		if info, err := os.Stat(filepath.Join(schemaDir, dir)); err == nil && info.IsDir() {
+			schemas.dirs = append(schemas.dirs, filepath.Join(schemaDir, dir))
+		}
+	}
+	schemas.dirs = append(schemas.dirs, schemaDir)
+
+	return schemas, nil
+}
+
+// addCRD adds the schemas of the versions of a CustomResourceDefinition. Other resources are ignored.
+func (s *manifestSchemas) addCRD(manifest map[string]any) error {
+	if manifest["kind"] != "CustomResourceDefinition" || apiGroup(fmt.Sprint(manifest["apiVersion"])) != "apiextensions.k8s.io" {
+		return nil
+	}
+
+	var crd struct {
+		Spec struct {
+			Group string `yaml:"group"`
+			Names struct {
+				Kind string `yaml:"kind"`
+			} `yaml:"names"`
+			Versions []struct {
+				Name   string `yaml:"name"`
+				Schema struct {
+					OpenAPIV3Schema map[string]any `yaml:"openAPIV3Schema"`
+				} `yaml:"schema"`
+			} `yaml:"versions"`
+		} `yaml:"spec"`
+	}
+	content, err := yaml.Marshal(manifest)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal(content, &crd); err != nil {
+		return err
+	}
+
+	for _, version := range crd.Spec.Versions {
+		if version.Schema.OpenAPIV3Schema == nil {
+			continue
+		}
+
+		// Round trip through JSON to get the value types the schema compiler expects
+		schemaJSON, err := json.Marshal(version.Schema.OpenAPIV3Schema)
+		if err != nil {
+			return err
+		}
+		schema, err := jsonschema.UnmarshalJSON(bytes.NewReader(schemaJSON))
+		if err != nil {
+			return err
+		}
+		s.crds[crd.Spec.Group+"/"+version.Name+"/"+crd.Spec.Names.Kind] = schema
+	}
+
+	return nil
+}
+
+// schema returns the compiled schema for a resource, or nil if there is none.
+func (s *manifestSchemas) schema(key ResourceKey) (*jsonschema.Schema, error) {
+	group, version := apiGroup(key.APIVersion), apiVersion(key.APIVersion)
+	gvk := group + "/" + version + "/" + key.Kind
+
+	if compiled, ok := s.compiled[gvk]; ok {
+		return compiled, nil
+	}
+
+	schema, ok := s.crds[gvk]
+	if !ok {
+		fileName := strings.ToLower(key.Kind)
+		if group != "" {
+			fileName += "-" + strings.Split(group, ".")[0]
+		}
+		fileName += "-" + version + ".json"
+
+		var err error
+		schema, err = s.readSchema(fileName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var compiled *jsonschema.Schema
+	if schema != nil {
+		var err error
+		compiled, err = compileSchema(schema, jsonschema.Draft4) // Kubernetes schemas are OpenAPI schemas, based on draft 4
+		if err != nil {
+			return nil, fmt.Errorf("error compiling schema for %v: %w", gvk, err)
+		}
+	}
+	s.compiled[gvk] = compiled
+
+	return compiled, nil
+}
+
+// readSchema reads a schema file from the first schema directory it is found in, or returns nil if none has it.
+func (s *manifestSchemas) readSchema(fileName string) (any, error) {
+	for _, dir := range s.dirs {
+		file, err := os.Open(filepath.Join(dir, fileName))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		schema, err := jsonschema.UnmarshalJSON(file)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding schema %v: %w", file.Name(), err)
+		}
+		if schemaMap, ok := schema.(map[string]any); ok {
+			delete(schemaMap, "$schema") // Often the generic http://json-schema.org/schema#, which names no draft
+		}
+
+		return schema, nil
+	}
+
+	return nil, nil
+}
+
+// apiGroup returns the group of an apiVersion, empty for the core group.
+func apiGroup(groupVersion string) string {
+	if group, _, ok := strings.Cut(groupVersion, "/"); ok {
+		return group
+	}
+
+	return ""
+}
+
+// apiVersion returns the version of an apiVersion.
+func apiVersion(groupVersion string) string {
+	if _, version, ok := strings.Cut(groupVersion, "/"); ok {
+		return version
+	}
+
+	return groupVersion
+}
+
+// isBuiltInGroup tells if an API group is served by Kubernetes itself, so a schema must exist for its kinds.
+func isBuiltInGroup(group string) bool {
+	return !strings.Contains(group, ".") || strings.HasSuffix(group, ".k8s.io")
+}
@@ -0,0 +1,81 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateManifests(t *testing.T) {
+	schemaDir := t.TempDir()
+	versionDir := filepath.Join(schemaDir, "v1.33.0-standalone-strict")
+	if err := os.MkdirAll(versionDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	schema := `{"type": "object", "properties": {"spec": {"type": "object", "properties": {"replicas": {"type": "integer"}}}}}`
+	if err := os.WriteFile(filepath.Join(versionDir, "deployment-apps-v1.json"), []byte(schema), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := `---
+apiVersion: apiextensions.k8s.io/v1
+kind: CustomResourceDefinition
+metadata:
+  name: widgets.example.com
+spec:
+  group: example.com
+  names:
+    kind: Widget
+  versions:
+    - name: v1
+      schema:
+        openAPIV3Schema:
+          type: object
+          properties:
+            spec:
+              type: object
+              properties:
+                size:
+                  type: integer
+---
+apiVersion: example.com/v1
+kind: Widget
+metadata:
+  name: w
+spec:
+  size: big
+---
+apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: "3"
+---
+apiVersion: v1
+kind: Sevrice
+metadata:
+  name: app
+`
+	doc := Document{Target: &Target{Path: "prod"}}
+	doc.Target.renderedReleases = []RenderedRelease{renderedRelease("app", manifest)}
+
+	GlobalCapabilities = Capabilities{KubeVersion: KubeVersion{Version: "v1.33.0"}}
+	t.Cleanup(func() { GlobalCapabilities = Capabilities{} })
+
+	violations, err := doc.ValidateManifests(schemaDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var found []string
+	for _, violation := range violations {
+		found = append(found, violation.Resource.Kind+" "+violation.Pointer)
+	}
+	// The CRD itself has no schema in schemaDir
+	expected := []string{"CustomResourceDefinition ", "Widget /spec/size", "Deployment /spec/replicas", "Sevrice "}
+	if strings.Join(found, ",") != strings.Join(expected, ",") {
+		t.Errorf("expected violations %v, got %v", expected, violations)
+	}
+}
@@ -6,14 +6,28 @@ import (
 	"os"
 	stdpath "path"
 	"path/filepath"
+	"slices"
+	"strings"
 
 	"github.com/go-openapi/jsonreference"
 	"github.com/goccy/go-yaml"
+	"github.com/stefan65535/helmer/internal/utils"
+	"helm.sh/helm/v4/pkg/chart/common"
+	"helm.sh/helm/v4/pkg/strvals"
 )
 
 var GlobalValues Values
 var GlobalCapabilities Capabilities
 var GlobalRelease Release
+var GlobalValueOverrides ValueOverrides
+
+// ValueOverrides are values set on the command line. They take precedence over the values in the configs.
+type ValueOverrides struct {
+	Values Values            // Values for all charts
+	Charts map[string]Values // Values for a single chart, keyed by the targetDir of the chart
+
+	used map[string]bool // Keys of Charts that matched a rendered chart
+}
 
 type Values map[string]any // TODO Do we need this to be a custom type? We could also just use map[string]any directly. The only reason to have this as a custom type would be to add helper functions on it, but we don't have any yet.
 
@@ -44,6 +58,67 @@ func InitGlobalValues() {
 	}
 }
 
+// MergeValueOverrides merges the command line values into the global values, so value references can point at them.
+func MergeValueOverrides() {
+	GlobalValues = utils.MergeMaps(GlobalValues, GlobalValueOverrides.Values)
+}
+
+// chartValues returns the values a chart is rendered with, the global values overridden by the chart values,
+// overridden in turn by the command line values and the command line values for the chart.
+func (o *ValueOverrides) chartValues(c *Chart) Values {
+	values := utils.MergeMaps(GlobalValues, c.Values)
+	values = utils.MergeMaps(values, o.Values)
+
+	if chartValues, ok := o.Charts[c.TargetDir]; ok {
+		values = utils.MergeMaps(values, chartValues)
+
+		if o.used == nil {
+			o.used = make(map[string]bool)
+		}
+		o.used[c.TargetDir] = true
+	}
+
+	return values
+}
+
+// ParseChartValues parses --set-chart flags like mychart:key1=val1,key2=val2 into values keyed by the chart name, the
+// targetDir of the chart. The values use Helm --set syntax, flags for the same chart are merged in order.
+func ParseChartValues(flags []string) (map[string]Values, error) {
+	chartValues := make(map[string]Values)
+	for _, flag := range flags {
+		chart, value, ok := strings.Cut(flag, ":")
+		if !ok || chart == "" {
+			return nil, fmt.Errorf("failed parsing --set-chart data %q, expected chart:key=value", flag)
+		}
+
+		if chartValues[chart] == nil {
+			chartValues[chart] = make(Values)
+		}
+		if err := strvals.ParseInto(value, chartValues[chart]); err != nil {
+			return nil, fmt.Errorf("failed parsing --set-chart data: %w", err)
+		}
+	}
+
+	return chartValues, nil
+}
+
+// CheckUnusedCharts returns an error naming the chart keys of the overrides that didn't match any rendered chart,
+// which is most likely a typo.
+func (o *ValueOverrides) CheckUnusedCharts() error {
+	var unused []string
+	for name := range o.Charts {
+		if !o.used[name] {
+			unused = append(unused, name)
+		}
+	}
+	if len(unused) == 0 {
+		return nil
+	}
+	slices.Sort(unused)
+
+	return fmt.Errorf("--set-chart: no chart with targetDir %v was rendered", strings.Join(unused, ", "))
+}
+
 type HelmerValues struct {
 	Target HelmerTarget `yaml:"Target"`
 }
@@ -53,21 +128,79 @@ type HelmerTarget struct {
 	SubDirs []string `yaml:"SubDirs"`
 }
 
+// ParseKubeVersion parses a Kubernetes version like v1.33.4 or 1.33 into a KubeVersion.
+func ParseKubeVersion(version string) (KubeVersion, error) {
+	kubeVersion, err := common.ParseKubeVersion(version)
+	if err != nil {
+		return KubeVersion{}, fmt.Errorf("invalid kube version %q: %w", version, err)
+	}
+
+	return KubeVersion{Version: kubeVersion.Version, Major: kubeVersion.Major, Minor: kubeVersion.Minor}, nil
+}
+
+// OverrideCapabilities overrides the global capabilities set by the configs with a kube version and API versions given
+// on the command line. An empty kube version or no API versions leave the ones of the configs.
+func OverrideCapabilities(kubeVersion string, apiVersions []string) error {
+	if kubeVersion != "" {
+		version, err := ParseKubeVersion(kubeVersion)
+		if err != nil {
+			return err
+		}
+		GlobalCapabilities.KubeVersion = version
+	}
+	if len(apiVersions) > 0 {
+		GlobalCapabilities.APIVersions = apiVersions
+	}
+
+	return nil
+}
+
+// helmKubeVersion returns the kube version for Helm, or nil if none is set and Helm should use its default.
+// If only major and minor are set, the version is major.minor.0.
+func (k KubeVersion) helmKubeVersion() (*common.KubeVersion, error) {
+	version := k.Version
+	if version == "" {
+		if k.Major == "" && k.Minor == "" {
+			return nil, nil
+		}
+		version = fmt.Sprintf("%v.%v.0", k.Major, k.Minor)
+	}
+
+	kubeVersion, err := common.ParseKubeVersion(version)
+	if err != nil {
+		return nil, fmt.Errorf("invalid kube version %q: %w", version, err)
+	}
+	if k.Major != "" {
+		kubeVersion.Major = k.Major
+	}
+	if k.Minor != "" {
+		kubeVersion.Minor = k.Minor
+	}
+
+	return kubeVersion, nil
+}
+
+// setGlobalCapsAndRelease applies the capabilities, release and hooks of a document to the global ones.
+// Release fields are overridden one by one, so a document can set the namespace without resetting the name.
 func setGlobalCapsAndRelease(doc *Document) {
 	if len(doc.Capabilities.APIVersions) > 0 {
 		GlobalCapabilities.APIVersions = doc.Capabilities.APIVersions
 	}
 
-	if doc.Capabilities.KubeVersion.Version != "" || doc.Capabilities.KubeVersion.Major != "" || GlobalCapabilities.KubeVersion.Minor != "" {
+	if doc.Capabilities.KubeVersion.Version != "" || doc.Capabilities.KubeVersion.Major != "" || doc.Capabilities.KubeVersion.Minor != "" {
 		GlobalCapabilities.KubeVersion.Version = doc.Capabilities.KubeVersion.Version
 		GlobalCapabilities.KubeVersion.Major = doc.Capabilities.KubeVersion.Major
 		GlobalCapabilities.KubeVersion.Minor = doc.Capabilities.KubeVersion.Minor
 	}
 
-	if doc.Release.Name != "" || doc.Release.Namespace != "" {
+	if doc.Release.Name != "" {
 		GlobalRelease.Name = doc.Release.Name
+	}
+	if doc.Release.Namespace != "" {
 		GlobalRelease.Namespace = doc.Release.Namespace
 	}
+
+	GlobalHooks = GlobalHooks.override(doc.Hooks)
 }
 
 func (h Values) ResolveValueRefs() error {
@@ -208,6 +341,22 @@ func resolveValueFileAndExternalRefs(nodes map[string]any, basePath string) erro
 				}
 			}
 
+			if childNode, ok := mapNode["$sops"]; ok {
+				value, err := resolveSOPS(childNode, basePath)
+				if err != nil {
+					return err
+				}
+				nodes[k] = value
+			}
+
+			if childNode, ok := mapNode["$env"]; ok {
+				value, err := resolveEnv(childNode, mapNode)
+				if err != nil {
+					return err
+				}
+				nodes[k] = value
+			}
+
 			if childNode, ok := mapNode["$ref"]; ok {
 				if ref, ok := childNode.(string); ok {
 					r, err := jsonreference.New(ref)
@@ -263,6 +412,76 @@ func resolveValueFileAndExternalRefs(nodes map[string]any, basePath string) erro
 	return nil
 }
 
+// resolveSOPS decrypts the SOPS encrypted file referenced by a $sops directive, relative to basePath.
+// Like an external $ref, the reference can have a JSON pointer fragment selecting part of the file.
+func resolveSOPS(sopsNode any, basePath string) (any, error) {
+	ref, ok := sopsNode.(string)
+	if !ok {
+		return nil, errors.New(`$sops field must have string value`)
+	}
+
+	r, err := jsonreference.New(ref)
+	if err != nil {
+		return nil, err
+	}
+	if r.HasFullURL && !r.HasFileScheme || r.GetURL().Path == "" {
+		return nil, fmt.Errorf(`$sops %v must reference a local file`, ref)
+	}
+
+	doc, err := decryptSOPSFile(stdpath.Join(basePath, r.GetURL().Path))
+	if err != nil {
+		return nil, err
+	}
+
+	if r.GetPointer().IsEmpty() {
+		return doc, nil
+	}
+
+	val, _, err := r.GetPointer().Get(doc)
+	if err != nil {
+		return nil, fmt.Errorf(`error evaluating $sops reference "%v": %w`, ref, err)
+	}
+
+	return val, nil
+}
+
+// resolveEnv returns the value of the environment variable named by an $env directive.
+// The value of a set variable is always a string. If the variable isn't set the default is used as is,
+// or an error is returned if the variable is required.
+func resolveEnv(envNode any, directive map[string]any) (any, error) {
+	name, ok := envNode.(string)
+	if !ok {
+		return nil, errors.New(`$env field must have string value`)
+	}
+
+	for key := range directive {
+		if key != "$env" && key != "default" && key != "required" {
+			return nil, fmt.Errorf(`$env %v must contain only default and required fields, got: %v`, name, key)
+		}
+	}
+
+	required := false
+	if requiredNode, ok := directive["required"]; ok {
+		if required, ok = requiredNode.(bool); !ok {
+			return nil, fmt.Errorf(`required field of $env %v must have boolean value`, name)
+		}
+	}
+
+	if value, ok := os.LookupEnv(name); ok {
+		return value, nil
+	}
+
+	if required {
+		return nil, fmt.Errorf("environment variable %v required by $env is not set", name)
+	}
+
+	if defaultValue, ok := directive["default"]; ok {
+		return defaultValue, nil
+	}
+
+	return "", nil
+}
+
 func resolveValueFileAndExternalRefsYamlNode(parent string, node any, path string) error {
 	if mapNode, ok := node.(map[string]any); ok {
 		return resolveValueFileAndExternalRefs(mapNode, path)
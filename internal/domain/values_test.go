@@ -0,0 +1,235 @@
+package domain
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveEnv(t *testing.T) {
+	t.Setenv("HELMER_TEST_SET", "from-env")
+	t.Setenv("HELMER_TEST_EMPTY", "")
+	t.Setenv("HELMER_TEST_UNSET", "") // Restored after the test
+	os.Unsetenv("HELMER_TEST_UNSET")
+
+	for _, test := range []struct {
+		name      string
+		directive map[string]any
+		expected  any
+		err       bool
+	}{
+		{"set", map[string]any{"$env": "HELMER_TEST_SET", "default": "fallback"}, "from-env", false},
+		{"set but empty", map[string]any{"$env": "HELMER_TEST_EMPTY", "default": "fallback"}, "", false},
+		{"set and required", map[string]any{"$env": "HELMER_TEST_SET", "required": true}, "from-env", false},
+		{"unset with default", map[string]any{"$env": "HELMER_TEST_UNSET", "default": uint64(3)}, uint64(3), false},
+		{"unset without default", map[string]any{"$env": "HELMER_TEST_UNSET"}, "", false},
+		{"unset and required", map[string]any{"$env": "HELMER_TEST_UNSET", "required": true, "default": "fallback"}, nil, true},
+		{"name not a string", map[string]any{"$env": uint64(1)}, nil, true},
+		{"required not a boolean", map[string]any{"$env": "HELMER_TEST_SET", "required": "yes"}, nil, true},
+		{"unknown field", map[string]any{"$env": "HELMER_TEST_SET", "value": "x"}, nil, true},
+	} {
+		value, err := resolveEnv(test.directive["$env"], test.directive)
+		if test.err {
+			if err == nil {
+				t.Errorf("%v: expected error, got %v", test.name, value)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: %v", test.name, err)
+			continue
+		}
+		if value != test.expected {
+			t.Errorf("%v: expected %#v, got %#v", test.name, test.expected, value)
+		}
+	}
+}
+
+func TestLoadDocumentResolvesTopLevelDirectives(t *testing.T) {
+	t.Setenv("HELMER_TEST_TOKEN", "s3cr3t")
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helmer.yaml")
+	config := `values:
+  token:
+    $env: HELMER_TEST_TOKEN
+  app:
+    token:
+      $env: HELMER_TEST_TOKEN
+`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	InitGlobalValues()
+	t.Cleanup(InitGlobalValues)
+	if _, err := LoadDocument(nil, path, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// Directives are resolved before the document values are merged into the global values, top level values included
+	if GlobalValues["token"] != "s3cr3t" {
+		t.Errorf("expected top level token s3cr3t, got %#v", GlobalValues["token"])
+	}
+	if expected := map[string]any{"token": "s3cr3t"}; !reflect.DeepEqual(GlobalValues["app"], expected) {
+		t.Errorf("expected app %v, got %#v", expected, GlobalValues["app"])
+	}
+}
+
+func TestParseChartValues(t *testing.T) {
+	chartValues, err := ParseChartValues([]string{"web:image.tag=v2,replicas=3", "db:enabled=false", "web:image.repository=nginx"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]Values{
+		"web": {"image": map[string]any{"tag": "v2", "repository": "nginx"}, "replicas": int64(3)},
+		"db":  {"enabled": false},
+	}
+	if !reflect.DeepEqual(chartValues, expected) {
+		t.Errorf("expected %v, got %v", expected, chartValues)
+	}
+
+	for _, flag := range []string{"replicas=3", ":replicas=3", "web:replicas"} {
+		if _, err := ParseChartValues([]string{flag}); err == nil {
+			t.Errorf("%v: expected error", flag)
+		}
+	}
+}
+
+func TestChartValuesPrecedence(t *testing.T) {
+	GlobalValues = Values{"a": "global", "b": "global", "c": "global", "d": "global"}
+	t.Cleanup(InitGlobalValues)
+
+	overrides := ValueOverrides{
+		Values: Values{"c": "set", "d": "set"},
+		Charts: map[string]Values{"web": {"d": "set-chart"}, "api": {"d": "set-chart"}},
+	}
+
+	// --set-chart overrides --set, which overrides the chart values, which override the global values
+	web := &Chart{TargetDir: "web", Values: Values{"b": "chart", "c": "chart", "d": "chart"}}
+	expected := Values{"a": "global", "b": "chart", "c": "set", "d": "set-chart"}
+	if values := overrides.chartValues(web); !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+
+	// The values for a chart only apply to the chart with that targetDir
+	db := &Chart{TargetDir: "db"}
+	expected = Values{"a": "global", "b": "global", "c": "set", "d": "set"}
+	if values := overrides.chartValues(db); !reflect.DeepEqual(values, expected) {
+		t.Errorf("expected %v, got %v", expected, values)
+	}
+
+	err := overrides.CheckUnusedCharts()
+	if err == nil || err.Error() != "--set-chart: no chart with targetDir api was rendered" {
+		t.Errorf("expected api to be reported as unused, got %v", err)
+	}
+
+	overrides.chartValues(&Chart{TargetDir: "api"})
+	if err := overrides.CheckUnusedCharts(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseKubeVersion(t *testing.T) {
+	for version, expected := range map[string]KubeVersion{
+		"v1.33.4": {Version: "v1.33.4", Major: "1", Minor: "33"},
+		"1.33":    {Version: "v1.33", Major: "1", Minor: "33"},
+	} {
+		kubeVersion, err := ParseKubeVersion(version)
+		if err != nil {
+			t.Errorf("%v: %v", version, err)
+			continue
+		}
+		if kubeVersion != expected {
+			t.Errorf("%v: expected %+v, got %+v", version, expected, kubeVersion)
+		}
+	}
+
+	for _, version := range []string{"", "latest", "1.x"} {
+		if _, err := ParseKubeVersion(version); err == nil {
+			t.Errorf("%q: expected error", version)
+		}
+	}
+}
+
+func TestHelmKubeVersion(t *testing.T) {
+	for _, test := range []struct {
+		kubeVersion KubeVersion
+		expected    string // Version, major and minor of the Helm kube version, empty if Helm should use its default
+		err         bool
+	}{
+		{KubeVersion{}, "", false},
+		{KubeVersion{Version: "v1.33.4"}, "v1.33.4 1 33", false},
+		{KubeVersion{Major: "1", Minor: "31"}, "v1.31.0 1 31", false},
+		{KubeVersion{Version: "v1.33.4", Minor: "33+"}, "v1.33.4 1 33+", false},
+		{KubeVersion{Version: "one"}, "", true},
+		{KubeVersion{Major: "1"}, "", true},
+	} {
+		kubeVersion, err := test.kubeVersion.helmKubeVersion()
+		if test.err {
+			if err == nil {
+				t.Errorf("%+v: expected error", test.kubeVersion)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%+v: %v", test.kubeVersion, err)
+			continue
+		}
+
+		var found string
+		if kubeVersion != nil {
+			found = kubeVersion.Version + " " + kubeVersion.Major + " " + kubeVersion.Minor
+		}
+		if found != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.kubeVersion, test.expected, found)
+		}
+	}
+}
+
+func TestOverrideCapabilities(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "helmer.yaml")
+	config := `capabilities:
+  apiVersions:
+    - example.com/v1
+  kubeVersion:
+    version: v1.29.2
+`
+	if err := os.WriteFile(path, []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	load := func() {
+		InitGlobalValues()
+		GlobalCapabilities = Capabilities{}
+		if _, err := LoadDocument(nil, path, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() { GlobalCapabilities = Capabilities{} })
+
+	// The kube version of the command line overrides the one of the config
+	load()
+	if err := OverrideCapabilities("v1.33.4", nil); err != nil {
+		t.Fatal(err)
+	}
+	expected := Capabilities{APIVersions: []string{"example.com/v1"}, KubeVersion: KubeVersion{Version: "v1.33.4", Major: "1", Minor: "33"}}
+	if !reflect.DeepEqual(GlobalCapabilities, expected) {
+		t.Errorf("expected %+v, got %+v", expected, GlobalCapabilities)
+	}
+
+	load()
+	if err := OverrideCapabilities("", nil); err != nil {
+		t.Fatal(err)
+	}
+	expected.KubeVersion = KubeVersion{Version: "v1.29.2"}
+	if !reflect.DeepEqual(GlobalCapabilities, expected) {
+		t.Errorf("expected %+v, got %+v", expected, GlobalCapabilities)
+	}
+
+	if err := OverrideCapabilities("latest", nil); err == nil {
+		t.Error("expected error for invalid kube version")
+	}
+}
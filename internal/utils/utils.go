@@ -1,6 +1,15 @@
 package utils
 
-import "maps"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+)
 
 // MergeMaps merges two maps. If a key exists in both maps, the value from b will be used.
 // If the value is a map, the maps will be merged recursively.
@@ -20,3 +29,65 @@ func MergeMaps(a, b map[string]interface{}) map[string]interface{} {
 	}
 	return out
 }
+
+// HashPath returns the sha256 digest of a file, or of the content of a directory, formatted as "sha256:<hex>".
+// A directory digest covers the relative path and content of every regular file in the directory tree,
+// so it changes when any file is added, removed, renamed or modified.
+func HashPath(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+
+	hash := sha256.New()
+
+	if !info.IsDir() {
+		if err := hashFile(hash, path); err != nil {
+			return "", err
+		}
+
+		return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	// WalkDir visits files in lexical order which makes the digest deterministic
+	err = filepath.WalkDir(path, func(file string, dirEntry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !dirEntry.Type().IsRegular() {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(path, file)
+		if err != nil {
+			return err
+		}
+
+		fmt.Fprintf(hash, "%v\x00", filepath.ToSlash(relPath))
+
+		fileHash := sha256.New()
+		if err := hashFile(fileHash, file); err != nil {
+			return err
+		}
+		hash.Write(fileHash.Sum(nil))
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return "sha256:" + hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func hashFile(w io.Writer, path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(w, file)
+
+	return err
+}